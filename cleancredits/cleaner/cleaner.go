@@ -1,13 +1,17 @@
 package cleaner
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"image"
+	"math"
 	"sync"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/container"
 	"fyne.io/fyne/v2/data/binding"
-	"fyne.io/fyne/v2/layout"
+	"fyne.io/fyne/v2/widget"
 	"gocv.io/x/gocv"
 
 	"github.com/sandalwoodbox/go-cleancredits/cleancredits/display"
@@ -16,6 +20,8 @@ import (
 	"github.com/sandalwoodbox/go-cleancredits/cleancredits/pipeline"
 	"github.com/sandalwoodbox/go-cleancredits/cleancredits/preview"
 	"github.com/sandalwoodbox/go-cleancredits/cleancredits/render"
+	"github.com/sandalwoodbox/go-cleancredits/cleancredits/scheduler"
+	"github.com/sandalwoodbox/go-cleancredits/cleancredits/settings"
 )
 
 const (
@@ -25,8 +31,8 @@ const (
 )
 
 type Cleaner struct {
-	Container    *fyne.Container
-	VideoCapture *gocv.VideoCapture
+	Container *fyne.Container
+	Capture   pipeline.Capture
 
 	MaskForm    mask.Form
 	DrawForm    draw.Form
@@ -34,39 +40,57 @@ type Cleaner struct {
 	RenderForm  render.Form
 	SelectedTab binding.String
 
-	UpdateChannel chan struct{}
-	UpdateLocker  *sync.Mutex
-	OnMaskUpdate  func()
-	ApplyChannel  chan struct{}
-	ApplyLocker   *sync.Mutex
-	Pipeline      *pipeline.Pipeline
-	Preview       preview.Preview
+	// Updater rebuilds the mask and Applier redraws the preview. Each
+	// coalesces rapid changes and cancels stale runs.
+	Updater  *scheduler.Scheduler
+	Applier  *scheduler.Scheduler
+	Pipeline *pipeline.Pipeline
+	Preview  *preview.Preview
+
+	// Inspector describes the pixel under the mouse in PixelInfo.
+	Inspector *scheduler.Scheduler
+	PixelInfo *widget.Label
+	hover     *hoverPosition
+
+	// sampleBox is the box being dragged out with the eyedropper, in video
+	// pixels.
+	sampleBox image.Rectangle
+}
+
+// hoverPosition is where the mouse is over the preview, in video pixels.
+type hoverPosition struct {
+	mu       sync.Mutex
+	x, y     float64
+	hovering bool
 }
 
-func New(vc *gocv.VideoCapture, w fyne.Window) (Cleaner, error) {
+func New(src settings.Source, vc pipeline.Capture, index *pipeline.SeekIndex, cacheOpts pipeline.CacheOptions, w fyne.Window) (Cleaner, error) {
 	videoWidth := int(vc.Get(gocv.VideoCaptureFrameWidth))
 	videoHeight := int(vc.Get(gocv.VideoCaptureFrameHeight))
-	frameCount := int(vc.Get(gocv.VideoCaptureFrameCount))
-	displayWidth := 720
-	displayHeight := 480
-	p, err := pipeline.NewPipeline(vc, displayWidth, displayHeight)
+	// The preview reports its real size once it has been laid out.
+	displayWidth := preview.DefaultWidth
+	displayHeight := preview.DefaultHeight
+	p, err := pipeline.NewPipeline(src, vc, index, cacheOpts, displayWidth, displayHeight)
 	if err != nil {
 		return Cleaner{}, fmt.Errorf("building pipeline: %v", err)
 	}
+	frameCount := p.FrameCount()
 	c := Cleaner{
-		VideoCapture:  vc,
-		MaskForm:      mask.NewForm(frameCount, videoWidth, videoHeight),
-		DrawForm:      draw.NewForm(frameCount),
-		DisplayForm:   display.NewForm(videoWidth, videoHeight, displayWidth, displayHeight),
-		SelectedTab:   binding.NewString(),
-		UpdateChannel: make(chan struct{}),
-		UpdateLocker:  &sync.Mutex{},
-		ApplyChannel:  make(chan struct{}),
-		ApplyLocker:   &sync.Mutex{},
-		Pipeline:      p,
-		Preview:       preview.NewPreview(displayWidth, displayHeight),
+		Capture:     vc,
+		MaskForm:    mask.NewForm(frameCount, videoWidth, videoHeight),
+		DrawForm:    draw.NewForm(frameCount),
+		DisplayForm: display.NewForm(videoWidth, videoHeight, displayWidth, displayHeight),
+		SelectedTab: binding.NewString(),
+		Pipeline:    p,
+		Preview:     preview.NewPreview(displayWidth, displayHeight),
+		PixelInfo:   widget.NewLabel(""),
+		hover:       &hoverPosition{},
 	}
 	c.RenderForm = render.NewForm(frameCount, c.Pipeline, w)
+	err = c.SelectedTab.Set(MaskTabName)
+	if err != nil {
+		fmt.Println("Error setting selected tab: ", err)
+	}
 	maskTab := container.NewTabItem(MaskTabName, c.MaskForm.Container)
 	drawTab := container.NewTabItem(DrawTabName, c.DrawForm.Container)
 	renderTab := container.NewTabItem(RenderTabName, c.RenderForm.Container)
@@ -81,60 +105,152 @@ func New(vc *gocv.VideoCapture, w fyne.Window) (Cleaner, error) {
 			c.SelectedTab.Set(RenderTabName)
 		}
 	}
-	right := container.New(
-		layout.NewVBoxLayout(),
-		c.DisplayForm.Container,
-		c.Preview.Container,
-	)
+	// The preview takes up all of the space that the forms don't need.
+	right := container.NewBorder(c.DisplayForm.Container, c.PixelInfo, nil, nil, c.Preview)
 
-	c.Container = container.New(layout.NewHBoxLayout(), left, right)
+	c.Container = container.NewBorder(nil, nil, left, nil, right)
+
+	// Listeners can fire as soon as they are added, so create both
+	// schedulers first.
+	c.Updater = scheduler.New(c.UpdateMask)
+	c.Applier = scheduler.New(c.ApplyMask)
+	c.Inspector = scheduler.New(c.Inspect)
 
 	// Update mask when mask/draw forms change
-	scheduleUpdate := func() {
-		select {
-		case c.UpdateChannel <- struct{}{}:
-			// fmt.Println("Update scheduled")
-		default:
-			// fmt.Println("Update already scheduled")
+	scheduleUpdateListener := binding.NewDataListener(c.Updater.Schedule)
+	c.SelectedTab.AddListener(scheduleUpdateListener)
+	c.MaskForm.OnChange(c.Updater.Schedule)
+	c.DrawForm.OnChange(c.Updater.Schedule)
+	// Switching proxy mode changes the resolution of the mask.
+	c.DisplayForm.Proxy.AddListener(scheduleUpdateListener)
+
+	// Update preview when display/render forms change (or mask update completes)
+	c.DisplayForm.OnChange(c.Applier.Schedule)
+	c.RenderForm.OnChange(c.Applier.Schedule)
+
+	c.Preview.OnResized = func(width, height int) {
+		c.Pipeline.SetDisplaySize(width, height)
+		c.DisplayForm.SetDisplaySize(width, height)
+		proxy, err := c.DisplayForm.Proxy.Get()
+		if err != nil {
+			fmt.Println("Error getting proxy: ", err)
 		}
+		// The proxy scale depends on the display size.
+		if proxy {
+			c.Updater.Schedule()
+		}
+		c.Applier.Schedule()
+	}
+
+	// Scroll to zoom around the cursor, and drag to pan.
+	c.Preview.OnScrolled = func(x, y, steps float64) {
+		vx, vy := c.Pipeline.DisplayToVideo(x, y)
+		c.DisplayForm.ZoomAt(vx, vy, x, y, steps)
 	}
-	go func() {
-		for range c.UpdateChannel {
-			c.UpdateLocker.Lock()
-			// Use another goroutine here to ensure UpdateChannel is consumed & unblocked
-			// immediately.
-			go func() {
-				c.UpdateMask()
-			}()
+	// With the crop tool selected on the Mask tab, dragging draws the crop
+	// instead, and with the eyedropper it samples a box of pixels.
+	var tool string
+	var panX, panY, dragX, dragY float64
+	c.Preview.OnDragStart = func(x, y float64) {
+		tool = c.activeTool()
+		switch tool {
+		case mask.ToolCrop:
+			ds, err := c.DisplayForm.Settings()
+			if err != nil {
+				fmt.Println("Error getting display settings: ", err)
+				return
+			}
+			vx, vy := c.Pipeline.DisplayToVideo(x, y)
+			c.MaskForm.StartCropDrag(vx, vy, preview.HandleSize/ds.Zoom)
+		case mask.ToolEyedropper:
+			dragX, dragY = c.Pipeline.DisplayToVideo(x, y)
+			c.sampleBox = pipeline.SampleRect(dragX, dragY, dragX, dragY)
+			c.UpdateOverlay()
+		default: // mask.ToolPan
+			panX, panY = c.Pipeline.DisplayToVideo(0, 0)
+			dragX, dragY = x, y
 		}
-	}()
-	scheduleUpdateListener := binding.NewDataListener(scheduleUpdate)
-	c.SelectedTab.AddListener(scheduleUpdateListener)
-	c.MaskForm.OnChange(scheduleUpdate)
-	c.DrawForm.OnChange(scheduleUpdate)
+	}
+	c.Preview.OnDragged = func(x, y float64) {
+		switch tool {
+		case mask.ToolCrop:
+			c.MaskForm.CropDragTo(c.Pipeline.DisplayToVideo(x, y))
+		case mask.ToolEyedropper:
+			vx, vy := c.Pipeline.DisplayToVideo(x, y)
+			c.sampleBox = pipeline.SampleRect(dragX, dragY, vx, vy)
+			c.UpdateOverlay()
+		default: // mask.ToolPan
+			ds, err := c.DisplayForm.Settings()
+			if err != nil {
+				fmt.Println("Error getting display settings: ", err)
+				return
+			}
+			c.DisplayForm.SetAnchor(panX-(x-dragX)/ds.Zoom, panY-(y-dragY)/ds.Zoom)
+		}
+	}
+	c.Preview.OnDragEnd = func() {
+		switch tool {
+		case mask.ToolCrop:
+			c.MaskForm.EndCropDrag()
+		case mask.ToolEyedropper:
+			c.Sample(c.sampleBox)
+			c.sampleBox = image.Rectangle{}
+			c.UpdateOverlay()
+		}
+		tool = ""
+	}
+	// Clicking with the crop tool adds a vertex to a polygon, and with the
+	// eyedropper it samples a single pixel.
+	c.Preview.OnTapped = func(x, y float64) {
+		switch c.activeTool() {
+		case mask.ToolCrop:
+			c.MaskForm.CropTap(c.Pipeline.DisplayToVideo(x, y))
+		case mask.ToolEyedropper:
+			vx, vy := c.Pipeline.DisplayToVideo(x, y)
+			c.Sample(pipeline.SampleRect(vx, vy, vx, vy))
+		}
+	}
+	// Describe the pixel under the mouse.
+	c.Preview.OnHover = func(x, y float64) {
+		vx, vy := c.Pipeline.DisplayToVideo(x, y)
+		c.hover.mu.Lock()
+		c.hover.x, c.hover.y, c.hover.hovering = vx, vy, true
+		c.hover.mu.Unlock()
+		c.Inspector.Schedule()
+	}
+	c.Preview.OnHoverEnd = func() {
+		c.hover.mu.Lock()
+		c.hover.hovering = false
+		c.hover.mu.Unlock()
+		c.Inspector.Schedule()
+	}
+	// Redraw the crop outlines straight away, rather than waiting for the
+	// mask to update.
+	c.MaskForm.OnCropChange(c.UpdateOverlay)
+	overlayListener := binding.NewDataListener(c.UpdateOverlay)
+	c.MaskForm.Tool.AddListener(overlayListener)
+	c.SelectedTab.AddListener(overlayListener)
 
-	// Update preview when display/render forms change (or mask update completes)
-	scheduleApply := func() {
-		select {
-		case c.ApplyChannel <- struct{}{}:
-			// fmt.Println("Apply scheduled")
-		default:
-			// fmt.Println("Apply already scheduled")
+	// Keep the frames that will be rendered in the disk cache.
+	setActiveRange := func() {
+		rs, err := c.RenderForm.Settings()
+		if err != nil {
+			fmt.Println("Error getting render settings: ", err)
+			return
 		}
+		c.Pipeline.FrameCache.SetActiveRange(rs.StartFrame, rs.EndFrame)
 	}
-	go func() {
-		for range c.ApplyChannel {
-			c.ApplyLocker.Lock()
-			// Use another goroutine here to ensure ApplyChannel is consumed & unblocked
-			// immediately.
-			go func() {
-				c.ApplyMask()
-			}()
+	setActiveRange()
+	c.RenderForm.OnChange(setActiveRange)
+	w.SetOnClosed(func() {
+		c.Updater.Close()
+		c.Applier.Close()
+		c.Inspector.Close()
+		err := c.Pipeline.FrameCache.Close()
+		if err != nil {
+			fmt.Println("Error removing disk cache: ", err)
 		}
-	}()
-	c.OnMaskUpdate = scheduleApply
-	c.DisplayForm.OnChange(scheduleApply)
-	c.RenderForm.OnChange(scheduleApply)
+	})
 
 	// Change draw tab frame when mask frame changes (but not vice versa)
 	c.MaskForm.Frame.AddListener(binding.NewDataListener(func() {
@@ -152,8 +268,10 @@ func New(vc *gocv.VideoCapture, w fyne.Window) (Cleaner, error) {
 
 	return c, nil
 }
-func (c *Cleaner) UpdateMask() {
-	defer c.UpdateLocker.Unlock()
+
+// UpdateMask rebuilds the mask from the current form values, then schedules
+// a preview update.
+func (c *Cleaner) UpdateMask(ctx context.Context) {
 	maskSettings, err := c.MaskForm.Settings()
 	if err != nil {
 		fmt.Println("Error getting mask settings: ", err)
@@ -164,22 +282,36 @@ func (c *Cleaner) UpdateMask() {
 		fmt.Println("Error getting draw settings: ", err)
 		return
 	}
+	displaySettings, err := c.DisplayForm.Settings()
+	if err != nil {
+		fmt.Println("Error getting display settings: ", err)
+		return
+	}
 
 	err = c.Pipeline.UpdateMask(
+		ctx,
 		maskSettings,
 		drawSettings,
+		displaySettings.Proxy,
 	)
+	if errors.Is(err, context.Canceled) {
+		return
+	}
 	if err != nil {
 		fmt.Println("Error updating mask: ", err)
 		return
 	}
-	c.OnMaskUpdate()
+	hists := c.Pipeline.Histograms
+	fyne.Do(func() {
+		c.MaskForm.SetHistograms(hists)
+	})
+	c.Applier.Schedule()
 }
 
-func (c *Cleaner) ApplyMask() {
+// ApplyMask renders the preview for the current form values.
+func (c *Cleaner) ApplyMask(ctx context.Context) {
 	// Don't proceed unless the mask has been rendered at least once.
-	if c.Pipeline.MaskWithOverrides == nil {
-		c.ApplyLocker.Unlock()
+	if !c.Pipeline.HasMask() {
 		return
 	}
 	displaySettings, err := c.DisplayForm.Settings()
@@ -190,14 +322,12 @@ func (c *Cleaner) ApplyMask() {
 	renderSettings, err := c.RenderForm.Settings()
 	if err != nil {
 		fmt.Println("Error getting render settings: ", err)
-		c.ApplyLocker.Unlock()
 		return
 	}
 
 	tabName, err := c.SelectedTab.Get()
 	if err != nil {
 		fmt.Println("Error getting selected tab: ", err)
-		c.ApplyLocker.Unlock()
 		return
 	}
 	var fNum int
@@ -209,15 +339,183 @@ func (c *Cleaner) ApplyMask() {
 	default: // MaskTabName
 		fNum, err = c.MaskForm.Frame.Get()
 	}
-	img, err := c.Pipeline.ApplyMask(fNum, displaySettings, renderSettings)
+	if err != nil {
+		fmt.Println("Error getting frame: ", err)
+		return
+	}
+	img, err := c.Pipeline.ApplyMask(ctx, fNum, displaySettings, renderSettings)
+	if errors.Is(err, context.Canceled) {
+		return
+	}
 	if err != nil {
 		fmt.Println("Error applying mask: ", err)
-		c.ApplyLocker.Unlock()
+		return
+	}
+	// A newer preview is on its way.
+	if ctx.Err() != nil {
 		return
 	}
 
 	fyne.Do(func() {
 		c.Preview.SetImage(img)
-		c.ApplyLocker.Unlock()
+		c.UpdateOverlay()
+	})
+	// The pixel under the mouse may have changed.
+	c.Inspector.Schedule()
+}
+
+// Inspect describes the pixel under the mouse, if it is over the preview.
+func (c *Cleaner) Inspect(ctx context.Context) {
+	c.hover.mu.Lock()
+	x, y, hovering := c.hover.x, c.hover.y, c.hover.hovering
+	c.hover.mu.Unlock()
+	text := ""
+	if hovering {
+		info, err := c.Pipeline.Inspect(x, y)
+		if err == nil {
+			text = info.String()
+		}
+	}
+	if ctx.Err() != nil {
+		return
+	}
+	fyne.Do(func() {
+		c.PixelInfo.SetText(text)
 	})
 }
+
+// activeTool returns what clicking and dragging on the preview does. The
+// Mask tab's tools only apply while it is open; otherwise the preview pans.
+func (c *Cleaner) activeTool() string {
+	tabName, err := c.SelectedTab.Get()
+	if err != nil {
+		fmt.Println("Error getting selected tab: ", err)
+		return mask.ToolPan
+	}
+	if tabName != MaskTabName {
+		return mask.ToolPan
+	}
+	tool, err := c.MaskForm.Tool.Get()
+	if err != nil {
+		fmt.Println("Error getting tool: ", err)
+		return mask.ToolPan
+	}
+	return tool
+}
+
+// Sample sets the mask's color ranges, or its reference colors, from the
+// pixels of the mask frame within r (in video pixels), using the eyedropper
+// settings.
+func (c *Cleaner) Sample(r image.Rectangle) {
+	ms, err := c.MaskForm.Settings()
+	if err != nil {
+		fmt.Println("Error getting mask settings: ", err)
+		return
+	}
+	tolerance, err := c.MaskForm.Tolerance.Get()
+	if err != nil {
+		fmt.Println("Error getting tolerance: ", err)
+		return
+	}
+	mode, err := c.MaskForm.SampleMode.Get()
+	if err != nil {
+		fmt.Println("Error getting sample mode: ", err)
+		return
+	}
+	if ms.Method == mask.MethodDistance {
+		ref, err := c.Pipeline.SampleFrameMean(ms.Frame, r)
+		if err != nil {
+			fmt.Println("Error sampling frame: ", err)
+			return
+		}
+		c.MaskForm.SetReferenceColors(pipeline.ApplyReferenceSample(ms.ReferenceColors, ref, ms.DeltaE, mode))
+		return
+	}
+	sample, err := c.Pipeline.SampleFrame(ms.Frame, r, ms.ColorSpace)
+	if err != nil {
+		fmt.Println("Error sampling frame: ", err)
+		return
+	}
+	c.MaskForm.SetRanges(pipeline.ApplySample(ms, sample, tolerance, mode))
+}
+
+// ellipseSegments is how many straight lines are used to outline an
+// ellipse.
+const ellipseSegments = 32
+
+// UpdateOverlay draws the crop regions over the preview while the Mask tab is
+// open, with handles for dragging the selected region if the crop tool is
+// selected.
+func (c *Cleaner) UpdateOverlay() {
+	tabName, err := c.SelectedTab.Get()
+	if err != nil {
+		fmt.Println("Error getting selected tab: ", err)
+		return
+	}
+	if tabName != MaskTabName {
+		c.Preview.SetOverlay(preview.Overlay{})
+		return
+	}
+	crops, err := c.MaskForm.Crops()
+	if err != nil {
+		fmt.Println("Error getting crops: ", err)
+		return
+	}
+	point := func(x, y float64) preview.Point {
+		dx, dy := c.Pipeline.VideoToDisplay(x, y)
+		return preview.Point{X: dx, Y: dy}
+	}
+	var o preview.Overlay
+	for _, crop := range crops {
+		r := image.Rect(crop.Left, crop.Top, crop.Right, crop.Bottom)
+		var outline []preview.Point
+		switch crop.Shape {
+		case mask.CropEllipse:
+			cx, cy := float64(r.Min.X+r.Max.X)/2, float64(r.Min.Y+r.Max.Y)/2
+			rx, ry := float64(r.Dx())/2, float64(r.Dy())/2
+			for i := range ellipseSegments {
+				a := 2 * math.Pi * float64(i) / ellipseSegments
+				outline = append(outline, point(cx+rx*math.Cos(a), cy+ry*math.Sin(a)))
+			}
+		case mask.CropPolygon:
+			for _, p := range crop.Points {
+				outline = append(outline, point(float64(p.X), float64(p.Y)))
+			}
+		default: // mask.CropRectangle
+			outline = []preview.Point{
+				point(float64(r.Min.X), float64(r.Min.Y)),
+				point(float64(r.Max.X), float64(r.Min.Y)),
+				point(float64(r.Max.X), float64(r.Max.Y)),
+				point(float64(r.Min.X), float64(r.Max.Y)),
+			}
+		}
+		o.Outlines = append(o.Outlines, outline)
+	}
+	if !c.sampleBox.Empty() {
+		r := c.sampleBox
+		o.Outlines = append(o.Outlines, []preview.Point{
+			point(float64(r.Min.X), float64(r.Min.Y)),
+			point(float64(r.Max.X), float64(r.Min.Y)),
+			point(float64(r.Max.X), float64(r.Max.Y)),
+			point(float64(r.Min.X), float64(r.Max.Y)),
+		})
+	}
+	if c.activeTool() == mask.ToolCrop {
+		selected := c.MaskForm.SelectedCrop()
+		crop := crops[selected]
+		if crop.Shape == mask.CropPolygon {
+			o.Handles = o.Outlines[selected]
+		} else {
+			r := image.Rect(crop.Left, crop.Top, crop.Right, crop.Bottom)
+			minX, minY := float64(r.Min.X), float64(r.Min.Y)
+			maxX, maxY := float64(r.Max.X), float64(r.Max.Y)
+			midX, midY := (minX+maxX)/2, (minY+maxY)/2
+			o.Handles = []preview.Point{
+				point(minX, minY), point(midX, minY), point(maxX, minY),
+				point(maxX, midY), point(maxX, maxY), point(midX, maxY),
+				point(minX, maxY), point(minX, midY),
+			}
+		}
+	}
+	c.Preview.SetOverlay(o)
+}
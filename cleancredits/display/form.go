@@ -5,6 +5,8 @@ import (
 	"maps"
 	"math"
 	"slices"
+	"strconv"
+	"strings"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/container"
@@ -14,6 +16,7 @@ import (
 	"fyne.io/fyne/v2/widget"
 
 	"github.com/sandalwoodbox/go-cleancredits/cleancredits/settings"
+	"github.com/sandalwoodbox/go-cleancredits/cleancredits/utils"
 	ccWidget "github.com/sandalwoodbox/go-cleancredits/cleancredits/widget"
 )
 
@@ -26,18 +29,14 @@ const (
 
 const ZoomFit = "Fit"
 
-var ZoomLevelToFactor = map[string]float64{
-	ZoomFit: 0,
-	"10%":   .10,
-	"25%":   .25,
-	"50%":   .5,
-	"100%":  1,
-	"150%":  1.5,
-	"200%":  2,
-	"300%":  3,
-	"400%":  4,
-	"500%":  5,
-}
+const (
+	// MinZoom and MaxZoom limit continuous (scroll wheel) zooming.
+	MinZoom = .01
+	MaxZoom = 20
+	// ZoomStep is how much one notch of the scroll wheel zooms by.
+	ZoomStep = 1.1
+)
+
 var ZoomFactorToLevel = map[float64]string{
 	0:   ZoomFit,
 	.10: "10%",
@@ -65,27 +64,32 @@ var ZoomLevels = []string{
 }
 
 type Form struct {
-	Container     *fyne.Container
-	DisplayWidth  int
-	DisplayHeight int
-	FitZoomFactor float64
+	Container   *fyne.Container
+	VideoWidth  int
+	VideoHeight int
+	// FitZoomFactor is the zoom factor that fits the whole video in the
+	// preview. It changes when the preview is resized.
+	FitZoomFactor binding.Float
 
 	Mode    binding.String
 	Zoom    binding.String
 	AnchorX binding.Int
 	AnchorY binding.Int
+	Proxy   binding.Bool
 }
 
 func NewForm(videoWidth, videoHeight, displayWidth, displayHeight int) Form {
 	f := Form{
-		DisplayWidth:  displayWidth,
-		DisplayHeight: displayHeight,
-		FitZoomFactor: math.Min(float64(displayWidth)/float64(videoWidth), float64(displayHeight)/float64(videoHeight)),
+		VideoWidth:    videoWidth,
+		VideoHeight:   videoHeight,
+		FitZoomFactor: binding.NewFloat(),
 		Mode:          binding.NewString(),
 		Zoom:          binding.NewString(),
 		AnchorX:       binding.NewInt(),
 		AnchorY:       binding.NewInt(),
+		Proxy:         binding.NewBool(),
 	}
+	f.SetDisplaySize(displayWidth, displayHeight)
 	err := f.Mode.Set(ViewMask)
 	if err != nil {
 		fmt.Println("Error setting mode: ", err)
@@ -102,6 +106,9 @@ func NewForm(videoWidth, videoHeight, displayWidth, displayHeight int) Form {
 	if err != nil {
 		fmt.Println("Error setting anchorY: ", err)
 	}
+	// Any percentage can be typed in, as well as picking a preset.
+	zoomEntry := widget.NewSelectEntry(ZoomLevels)
+	zoomEntry.Bind(f.Zoom)
 	anchorXEntry := ccWidget.NewIntEntryWithData(0, videoWidth, f.AnchorX)
 	anchorYEntry := ccWidget.NewIntEntryWithData(0, videoHeight, f.AnchorY)
 	f.Container =
@@ -117,15 +124,15 @@ func NewForm(videoWidth, videoHeight, displayWidth, displayHeight int) Form {
 				},
 				f.Mode),
 			widget.NewLabel("Zoom"),
-			widget.NewSelectWithData(
-				ZoomLevels, f.Zoom,
-			),
+			zoomEntry,
 			widget.NewButtonWithIcon("", theme.ZoomInIcon(), f.ZoomIn),
 			widget.NewButtonWithIcon("", theme.ZoomOutIcon(), f.ZoomOut),
 			widget.NewLabel("Anchor X"),
 			anchorXEntry,
 			widget.NewLabel("Y"),
 			anchorYEntry,
+			// Proxy mode previews downscaled frames; renders are always full resolution.
+			widget.NewCheckWithData("Proxy", f.Proxy),
 		)
 	return f
 }
@@ -136,6 +143,76 @@ func (f Form) OnChange(fn func()) {
 	f.Zoom.AddListener(l)
 	f.AnchorX.AddListener(l)
 	f.AnchorY.AddListener(l)
+	f.Proxy.AddListener(l)
+	f.FitZoomFactor.AddListener(l)
+}
+
+// SetDisplaySize updates FitZoomFactor for a preview of the given size.
+func (f Form) SetDisplaySize(displayWidth, displayHeight int) {
+	err := f.FitZoomFactor.Set(math.Min(float64(displayWidth)/float64(f.VideoWidth), float64(displayHeight)/float64(f.VideoHeight)))
+	if err != nil {
+		fmt.Println("Error setting FitZoomFactor: ", err)
+	}
+}
+
+// zoomFactor returns the zoom factor for a zoom level.
+func (f Form) zoomFactor(zoom string) (float64, error) {
+	if zoom == ZoomFit {
+		return f.FitZoomFactor.Get()
+	}
+	return ParseZoom(zoom)
+}
+
+// ParseZoom returns the zoom factor for a percentage such as "150%". The
+// percent sign is optional.
+func ParseZoom(zoom string) (float64, error) {
+	pct, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(zoom), "%")), 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid zoom %q", zoom)
+	}
+	if pct <= 0 {
+		return 0, fmt.Errorf("zoom must be positive: %q", zoom)
+	}
+	return pct / 100, nil
+}
+
+// FormatZoom returns zf as a percentage, to one decimal place.
+func FormatZoom(zf float64) string {
+	return strconv.FormatFloat(math.Round(zf*1000)/10, 'f', -1, 64) + "%"
+}
+
+// SetZoom sets the zoom factor, clamped to MinZoom-MaxZoom.
+func (f Form) SetZoom(zf float64) {
+	err := f.Zoom.Set(FormatZoom(math.Min(math.Max(zf, MinZoom), MaxZoom)))
+	if err != nil {
+		fmt.Println("Error setting Zoom: ", err)
+	}
+}
+
+// SetAnchor centres the view on a point in the video.
+func (f Form) SetAnchor(x, y float64) {
+	err := f.AnchorX.Set(utils.ClampInt(int(math.Round(x)), 0, f.VideoWidth))
+	if err != nil {
+		fmt.Println("Error setting AnchorX: ", err)
+	}
+	err = f.AnchorY.Set(utils.ClampInt(int(math.Round(y)), 0, f.VideoHeight))
+	if err != nil {
+		fmt.Println("Error setting AnchorY: ", err)
+	}
+}
+
+// ZoomAt changes the zoom by steps notches of ZoomStep while keeping the
+// video point (videoX, videoY) under the same spot in the preview. x and y
+// are that spot's offset from the centre of the preview, in display pixels.
+func (f Form) ZoomAt(videoX, videoY, x, y, steps float64) {
+	ds, err := f.Settings()
+	if err != nil {
+		fmt.Println("Error getting display settings: ", err)
+		return
+	}
+	zf := math.Min(math.Max(ds.Zoom*math.Pow(ZoomStep, steps), MinZoom), MaxZoom)
+	f.SetZoom(zf)
+	f.SetAnchor(videoX-x/zf, videoY-y/zf)
 }
 
 func (f Form) Settings() (settings.Display, error) {
@@ -148,9 +225,9 @@ func (f Form) Settings() (settings.Display, error) {
 	if err != nil {
 		return settings.Display{}, fmt.Errorf("getting zoom: %v", err)
 	}
-	zf := ZoomLevelToFactor[zoom]
-	if zoom == ZoomFit {
-		zf = f.FitZoomFactor
+	zf, err := f.zoomFactor(zoom)
+	if err != nil {
+		return settings.Display{}, fmt.Errorf("getting zoom factor: %v", err)
 	}
 
 	anchorX, err := f.AnchorX.Get()
@@ -162,11 +239,17 @@ func (f Form) Settings() (settings.Display, error) {
 	if err != nil {
 		return settings.Display{}, fmt.Errorf("getting anchorY: %v", err)
 	}
+
+	proxy, err := f.Proxy.Get()
+	if err != nil {
+		return settings.Display{}, fmt.Errorf("getting proxy: %v", err)
+	}
 	return settings.Display{
 		Mode:    mode,
 		Zoom:    zf,
 		AnchorX: anchorX,
 		AnchorY: anchorY,
+		Proxy:   proxy,
 	}, nil
 }
 
@@ -176,18 +259,16 @@ func (f Form) ZoomIn() {
 		fmt.Println("Error getting Zoom: ", err)
 		return
 	}
-	zf := ZoomLevelToFactor[zoom]
-	if zoom == ZoomFit {
-		zf = f.FitZoomFactor
+	zf, err := f.zoomFactor(zoom)
+	if err != nil {
+		fmt.Println("Error getting zoom factor: ", err)
+		return
 	}
 
 	// Return the first zoom level that the current zoom is smaller than.
 	for _, v := range slices.Sorted(maps.Keys(ZoomFactorToLevel)) {
 		if zf < v {
-			err = f.Zoom.Set(ZoomFactorToLevel[v])
-			if err != nil {
-				fmt.Println("Error setting Zoom: ", err)
-			}
+			f.SetZoom(v)
 			return
 		}
 	}
@@ -199,9 +280,10 @@ func (f Form) ZoomOut() {
 		fmt.Println("Error getting Zoom: ", err)
 		return
 	}
-	zf := ZoomLevelToFactor[zoom]
-	if zoom == ZoomFit {
-		zf = f.FitZoomFactor
+	zf, err := f.zoomFactor(zoom)
+	if err != nil {
+		fmt.Println("Error getting zoom factor: ", err)
+		return
 	}
 
 	// Return the first zoom level that the current zoom is larger than.
@@ -209,10 +291,7 @@ func (f Form) ZoomOut() {
 	slices.Reverse(zfs)
 	for _, v := range zfs {
 		if zf > v || v == .1 {
-			err = f.Zoom.Set(ZoomFactorToLevel[v])
-			if err != nil {
-				fmt.Println("Error setting Zoom: ", err)
-			}
+			f.SetZoom(v)
 			return
 		}
 	}
@@ -0,0 +1,38 @@
+package cleancredits
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/sandalwoodbox/go-cleancredits/cleancredits/pipeline"
+	"github.com/sandalwoodbox/go-cleancredits/cleancredits/project"
+	"github.com/sandalwoodbox/go-cleancredits/cleancredits/settings"
+)
+
+// RunY4M builds the mask for the project saved at projectPath, then cleans a
+// YUV4MPEG2 stream read from r and writes the result to w.
+func RunY4M(projectPath string, r io.Reader, w io.Writer) error {
+	proj, err := project.Load(projectPath)
+	if err != nil {
+		return err
+	}
+	vc, err := pipeline.OpenCapture(proj.Source)
+	if err != nil {
+		return fmt.Errorf("opening %s: %v", proj.Source.Path, err)
+	}
+	defer vc.Close()
+	index, err := pipeline.IndexSource(proj.Source)
+	if err != nil {
+		fmt.Println("Error indexing source; seeking may be inaccurate: ", err)
+	}
+	p, err := pipeline.NewPipeline(proj.Source, vc, index, pipeline.DefaultCacheOptions, 0, 0)
+	if err != nil {
+		return fmt.Errorf("building pipeline: %v", err)
+	}
+	err = p.UpdateMask(context.Background(), proj.Mask, settings.Draw{Frame: proj.Mask.Frame}, false)
+	if err != nil {
+		return fmt.Errorf("rendering mask: %v", err)
+	}
+	return p.StreamY4M(r, w, proj.Render)
+}
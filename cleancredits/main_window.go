@@ -7,25 +7,42 @@ import (
 	"fyne.io/fyne/v2/container"
 	"fyne.io/fyne/v2/dialog"
 	"fyne.io/fyne/v2/layout"
+	"fyne.io/fyne/v2/storage"
 	"fyne.io/fyne/v2/widget"
-	"gocv.io/x/gocv"
 
 	"github.com/sandalwoodbox/go-cleancredits/cleancredits/cleaner"
+	"github.com/sandalwoodbox/go-cleancredits/cleancredits/pipeline"
+	"github.com/sandalwoodbox/go-cleancredits/cleancredits/preferences"
+	"github.com/sandalwoodbox/go-cleancredits/cleancredits/settings"
 )
 
 func NewMainWindow(a fyne.App) fyne.Window {
 	w := a.NewWindow("cleancredits")
 	w.SetMaster()
+	preferences.SetDefaults(a.Preferences())
 
-	button := widget.NewButton("Open video file", func() { openVideo(w) })
-	content := container.New(layout.NewCenterLayout(), button)
+	content := container.New(
+		layout.NewCenterLayout(),
+		container.New(
+			layout.NewVBoxLayout(),
+			widget.NewButton("Open video file", func() { openSource(w, pipeline.SourceVideo, nil) }),
+			// Selecting any frame of a numbered image sequence opens the whole sequence.
+			widget.NewButton("Open image sequence", func() {
+				openSource(w, pipeline.SourceSequence, storage.NewExtensionFileFilter(pipeline.ImageExtensions))
+			}),
+			widget.NewButton("Open image", func() {
+				openSource(w, pipeline.SourceImage, storage.NewExtensionFileFilter(pipeline.ImageExtensions))
+			}),
+			widget.NewButton("Preferences", func() { preferences.ShowDialog(a.Preferences(), w) }),
+		),
+	)
 	w.Resize(fyne.NewSize(720, 480))
 	w.SetContent(content)
 	return w
 }
 
-func openVideo(w fyne.Window) {
-	dialog.ShowFileOpen(func(reader fyne.URIReadCloser, err error) {
+func openSource(w fyne.Window, kind string, filter storage.FileFilter) {
+	d := dialog.NewFileOpen(func(reader fyne.URIReadCloser, err error) {
 		if err != nil {
 			dialog.ShowError(fmt.Errorf("error loading file: %v", err), w)
 			return
@@ -35,20 +52,42 @@ func openVideo(w fyne.Window) {
 			return
 		}
 
-		videoPath := reader.URI().Path()
-		reader.Close()
-		vc, err := gocv.VideoCaptureFile(videoPath)
-		if err != nil {
-			fmt.Println("Error loading video file: ", err)
-			w.Close()
-			return
+		src := settings.Source{
+			Path: reader.URI().Path(),
+			Kind: kind,
 		}
-		c, err := cleaner.New(vc, w)
+		reader.Close()
+		vc, err := pipeline.OpenCapture(src)
 		if err != nil {
-			fmt.Println("Error building interface: ", err)
+			fmt.Println("Error loading file: ", err)
 			w.Close()
 			return
 		}
-		w.SetContent(c.Container)
+		// Indexing reads through the whole video, so do it in the background.
+		loading := dialog.NewCustomWithoutButtons("Loading", widget.NewProgressBarInfinite(), w)
+		loading.Show()
+		go func() {
+			index, err := pipeline.IndexSource(src)
+			if err != nil {
+				fmt.Println("Error indexing source; seeking may be inaccurate: ", err)
+			}
+			fyne.Do(func() {
+				loading.Hide()
+				cacheOpts := preferences.CacheOptions(fyne.CurrentApp().Preferences())
+				c, err := cleaner.New(src, vc, index, cacheOpts, w)
+				if err != nil {
+					fmt.Println("Error building interface: ", err)
+					w.Close()
+					return
+				}
+				w.SetContent(c.Container)
+				// The preview grows with the window, so start with plenty of room.
+				w.Resize(w.Canvas().Size().Max(fyne.NewSize(1280, 720)))
+			})
+		}()
 	}, w)
+	if filter != nil {
+		d.SetFilter(filter)
+	}
+	d.Show()
 }
@@ -0,0 +1,137 @@
+package mask
+
+import (
+	"fmt"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/data/binding"
+	"fyne.io/fyne/v2/widget"
+
+	ccWidget "github.com/sandalwoodbox/go-cleancredits/cleancredits/widget"
+)
+
+const (
+	ColorSpaceHSV   = "HSV"
+	ColorSpaceHLS   = "HLS"
+	ColorSpaceLab   = "Lab"
+	ColorSpaceYCrCb = "YCrCb"
+	ColorSpaceRGB   = "RGB"
+)
+
+var ColorSpaces = []string{ColorSpaceHSV, ColorSpaceHLS, ColorSpaceLab, ColorSpaceYCrCb, ColorSpaceRGB}
+
+// Channels describes the three channels of a color space, as OpenCV stores
+// them in 8 bit frames.
+type Channels struct {
+	Names [3]string
+	Max   [3]int
+	// Hue is true if the first channel is a hue, which wraps around.
+	Hue bool
+}
+
+// ColorSpaceChannels returns the channels of colorSpace. Unknown color spaces
+// are treated as HSV.
+func ColorSpaceChannels(colorSpace string) Channels {
+	switch colorSpace {
+	case ColorSpaceHLS:
+		return Channels{Names: [3]string{"Hue", "Light", "Sat"}, Max: [3]int{HueMax, 255, 255}, Hue: true}
+	case ColorSpaceLab:
+		return Channels{Names: [3]string{"L", "a", "b"}, Max: [3]int{255, 255, 255}}
+	case ColorSpaceYCrCb:
+		return Channels{Names: [3]string{"Y", "Cr", "Cb"}, Max: [3]int{255, 255, 255}}
+	case ColorSpaceRGB:
+		return Channels{Names: [3]string{"Red", "Green", "Blue"}, Max: [3]int{255, 255, 255}}
+	default: // ColorSpaceHSV
+		return Channels{Names: [3]string{"Hue", "Sat", "Val"}, Max: [3]int{HueMax, SatMax, ValMax}, Hue: true}
+	}
+}
+
+// channelControls are the controls for the color ranges, which are relabeled
+// to match the color space.
+type channelControls struct {
+	space   string
+	labels  [3]*widget.Label
+	sliders [3]*ccWidget.IntRangeSlider
+	entries [3][2]*ccWidget.IntEntry
+	// histograms plot the values inside the crop, above each slider.
+	histograms [3]*ccWidget.Histogram
+}
+
+// ranges returns the min and max bindings of each channel.
+func (f Form) ranges() [3][2]binding.Int {
+	return [3][2]binding.Int{
+		{f.Min[0], f.Max[0]},
+		{f.Min[1], f.Max[1]},
+		{f.Min[2], f.Max[2]},
+	}
+}
+
+func (f Form) newChannelControls() *channelControls {
+	c := &channelControls{space: ColorSpaceHSV}
+	ch := ColorSpaceChannels(c.space)
+	for i, r := range f.ranges() {
+		c.labels[i] = widget.NewLabel(ch.Names[i])
+		c.sliders[i] = ccWidget.NewIntRangeSliderWithData(0, ch.Max[i], r[0], r[1])
+		c.histograms[i] = ccWidget.NewHistogramWithData(0, ch.Max[i], r[0], r[1])
+		// Only hue ranges wrap around.
+		c.sliders[i].Wrap = ch.Hue && i == 0
+		c.histograms[i].Wrap = ch.Hue && i == 0
+		for j, b := range r {
+			c.entries[i][j] = ccWidget.NewIntEntryWithData(0, ch.Max[i], b)
+		}
+	}
+	return c
+}
+
+// rows returns the controls as rows of a three column grid, with the min and
+// max entries side by side.
+func (c *channelControls) rows() []fyne.CanvasObject {
+	var objects []fyne.CanvasObject
+	for i := range c.labels {
+		objects = append(objects,
+			c.labels[i],
+			container.NewVBox(c.histograms[i], c.sliders[i]),
+			container.NewGridWithColumns(2, c.entries[i][0], c.entries[i][1]),
+		)
+	}
+	return objects
+}
+
+// colorSpaceChanged relabels the range controls for the new color space and
+// resets the ranges to cover all of it.
+func (f Form) colorSpaceChanged() {
+	space, err := f.ColorSpace.Get()
+	if err != nil {
+		fmt.Println("Error getting ColorSpace: ", err)
+		return
+	}
+	if space == f.channels.space {
+		return
+	}
+	f.channels.space = space
+	ch := ColorSpaceChannels(space)
+	for i, r := range f.ranges() {
+		f.channels.labels[i].SetText(ch.Names[i])
+		f.channels.sliders[i].SetRange(0, ch.Max[i])
+		f.channels.sliders[i].SetWrap(ch.Hue && i == 0)
+		// The histograms are out of date until the mask is updated.
+		f.channels.histograms[i].SetRange(0, ch.Max[i])
+		f.channels.histograms[i].SetWrap(ch.Hue && i == 0)
+		f.channels.histograms[i].SetCounts(nil)
+		for j, b := range r {
+			f.channels.entries[i][j].SetRange(0, ch.Max[i])
+			err := b.Set([]int{0, ch.Max[i]}[j])
+			if err != nil {
+				fmt.Println("Error resetting color range: ", err)
+			}
+		}
+	}
+}
+
+// SetHistograms plots the values of each channel inside the crop.
+func (f Form) SetHistograms(hists [3][]int) {
+	for i, h := range hists {
+		f.channels.histograms[i].SetCounts(h)
+	}
+}
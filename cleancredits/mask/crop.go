@@ -0,0 +1,410 @@
+package mask
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"slices"
+	"sync"
+
+	"fyne.io/fyne/v2/data/binding"
+	"fyne.io/fyne/v2/widget"
+
+	"github.com/sandalwoodbox/go-cleancredits/cleancredits/settings"
+	"github.com/sandalwoodbox/go-cleancredits/cleancredits/utils"
+)
+
+const (
+	ToolPan        = "Pan"
+	ToolCrop       = "Crop"
+	ToolEyedropper = "Eyedropper"
+)
+
+const (
+	CropRectangle = "Rectangle"
+	CropEllipse   = "Ellipse"
+	CropPolygon   = "Polygon"
+)
+
+var CropShapes = []string{CropRectangle, CropEllipse, CropPolygon}
+
+// cropRegions holds the crop regions of a mask. The shape and bounds of the
+// selected region are kept in the Form's bindings; everything else is kept
+// here.
+type cropRegions struct {
+	mu       sync.Mutex
+	list     []settings.Crop
+	selected int
+	drag     cropDrag
+	selector *widget.Select
+}
+
+// cropDrag records which edges of the crop rectangle, or which polygon
+// vertex, is being dragged.
+type cropDrag struct {
+	left, top, right, bottom bool
+	// vertex is -1 if no vertex is being dragged.
+	vertex int
+}
+
+// Crops returns every crop region, in video pixels.
+func (f Form) Crops() ([]settings.Crop, error) {
+	selected, err := f.selectedCrop()
+	if err != nil {
+		return nil, err
+	}
+	f.crops.mu.Lock()
+	defer f.crops.mu.Unlock()
+	crops := make([]settings.Crop, len(f.crops.list))
+	for i, c := range f.crops.list {
+		if i == f.crops.selected {
+			selected.Points = c.Points
+			c = selected
+		}
+		c.Points = slices.Clone(c.Points)
+		crops[i] = c
+	}
+	return crops, nil
+}
+
+// SelectedCrop returns the index of the region being edited.
+func (f Form) SelectedCrop() int {
+	f.crops.mu.Lock()
+	defer f.crops.mu.Unlock()
+	return f.crops.selected
+}
+
+// selectedCrop returns the selected region's shape and bounds from the
+// bindings, without its points.
+func (f Form) selectedCrop() (settings.Crop, error) {
+	shape, err := f.CropShape.Get()
+	if err != nil {
+		return settings.Crop{}, fmt.Errorf("getting cropShape: %v", err)
+	}
+	r, err := f.CropRect()
+	if err != nil {
+		return settings.Crop{}, err
+	}
+	return settings.Crop{
+		Shape:  shape,
+		Left:   r.Min.X,
+		Top:    r.Min.Y,
+		Right:  r.Max.X,
+		Bottom: r.Max.Y,
+	}, nil
+}
+
+// AddCrop adds a crop region covering the whole frame and selects it.
+func (f Form) AddCrop() {
+	f.storeSelected()
+	f.crops.mu.Lock()
+	f.crops.list = append(f.crops.list, f.fullFrameCrop())
+	f.crops.selected = len(f.crops.list) - 1
+	f.crops.mu.Unlock()
+	f.loadSelected()
+}
+
+// RemoveCrop removes the selected crop region. The last region can't be
+// removed.
+func (f Form) RemoveCrop() {
+	f.crops.mu.Lock()
+	if len(f.crops.list) <= 1 {
+		f.crops.mu.Unlock()
+		return
+	}
+	f.crops.list = slices.Delete(f.crops.list, f.crops.selected, f.crops.selected+1)
+	f.crops.selected = min(f.crops.selected, len(f.crops.list)-1)
+	f.crops.mu.Unlock()
+	f.loadSelected()
+}
+
+// SelectCrop makes region i the one being edited.
+func (f Form) SelectCrop(i int) {
+	f.crops.mu.Lock()
+	if i < 0 || i >= len(f.crops.list) || i == f.crops.selected {
+		f.crops.mu.Unlock()
+		return
+	}
+	f.crops.mu.Unlock()
+	f.storeSelected()
+	f.crops.mu.Lock()
+	f.crops.selected = i
+	f.crops.mu.Unlock()
+	f.loadSelected()
+}
+
+func (f Form) fullFrameCrop() settings.Crop {
+	return settings.Crop{
+		Shape:  CropRectangle,
+		Right:  f.VideoWidth,
+		Bottom: f.VideoHeight,
+	}
+}
+
+// storeSelected copies the bindings into the selected region.
+func (f Form) storeSelected() {
+	c, err := f.selectedCrop()
+	if err != nil {
+		fmt.Println("Error getting crop: ", err)
+		return
+	}
+	f.crops.mu.Lock()
+	defer f.crops.mu.Unlock()
+	c.Points = f.crops.list[f.crops.selected].Points
+	f.crops.list[f.crops.selected] = c
+}
+
+// loadSelected copies the selected region into the bindings.
+func (f Form) loadSelected() {
+	f.crops.mu.Lock()
+	c := f.crops.list[f.crops.selected]
+	f.crops.mu.Unlock()
+	err := f.CropShape.Set(c.Shape)
+	if err != nil {
+		fmt.Println("Error setting cropShape: ", err)
+	}
+	f.SetCropRect(image.Rectangle{Min: image.Pt(c.Left, c.Top), Max: image.Pt(c.Right, c.Bottom)})
+	f.cropsUpdated()
+}
+
+// cropsUpdated refreshes the region list and tells listeners that the
+// regions have changed.
+func (f Form) cropsUpdated() {
+	shape, err := f.CropShape.Get()
+	if err != nil {
+		fmt.Println("Error getting cropShape: ", err)
+	}
+	f.crops.mu.Lock()
+	options := make([]string, len(f.crops.list))
+	for i, c := range f.crops.list {
+		if i == f.crops.selected {
+			c.Shape = shape
+		}
+		options[i] = fmt.Sprintf("%d: %s", i+1, c.Shape)
+	}
+	selected := f.crops.selected
+	f.crops.mu.Unlock()
+	if f.crops.selector != nil {
+		f.crops.selector.SetOptions(options)
+		f.crops.selector.SetSelectedIndex(selected)
+	}
+	n, err := f.cropsChanged.Get()
+	if err != nil {
+		fmt.Println("Error getting cropsChanged: ", err)
+	}
+	err = f.cropsChanged.Set(n + 1)
+	if err != nil {
+		fmt.Println("Error setting cropsChanged: ", err)
+	}
+}
+
+// shapeChanged starts a polygon from the bounds of the selected region, if
+// it doesn't have any points yet.
+func (f Form) shapeChanged() {
+	c, err := f.selectedCrop()
+	if err != nil {
+		fmt.Println("Error getting crop: ", err)
+		return
+	}
+	f.crops.mu.Lock()
+	points := &f.crops.list[f.crops.selected].Points
+	if c.Shape == CropPolygon && len(*points) == 0 {
+		r := image.Rect(c.Left, c.Top, c.Right, c.Bottom)
+		*points = []image.Point{r.Min, image.Pt(r.Max.X, r.Min.Y), r.Max, image.Pt(r.Min.X, r.Max.Y)}
+	}
+	f.crops.mu.Unlock()
+	f.cropsUpdated()
+}
+
+// ClearCropPoints removes every vertex from the selected polygon.
+func (f Form) ClearCropPoints() {
+	f.crops.mu.Lock()
+	f.crops.list[f.crops.selected].Points = nil
+	f.crops.mu.Unlock()
+	f.cropsUpdated()
+}
+
+// CropTap adds a vertex at the video point (x, y) if the selected region is a
+// polygon.
+func (f Form) CropTap(x, y float64) {
+	if !f.editingPolygon() {
+		return
+	}
+	f.crops.mu.Lock()
+	c := &f.crops.list[f.crops.selected]
+	c.Points = append(c.Points, f.clampPoint(x, y))
+	f.crops.mu.Unlock()
+	f.cropsUpdated()
+}
+
+func (f Form) editingPolygon() bool {
+	shape, err := f.CropShape.Get()
+	if err != nil {
+		fmt.Println("Error getting cropShape: ", err)
+		return false
+	}
+	return shape == CropPolygon
+}
+
+// CropRect returns the crop rectangle, in video pixels.
+func (f Form) CropRect() (image.Rectangle, error) {
+	left, err := f.CropLeft.Get()
+	if err != nil {
+		return image.Rectangle{}, fmt.Errorf("getting cropLeft: %v", err)
+	}
+	top, err := f.CropTop.Get()
+	if err != nil {
+		return image.Rectangle{}, fmt.Errorf("getting cropTop: %v", err)
+	}
+	right, err := f.CropRight.Get()
+	if err != nil {
+		return image.Rectangle{}, fmt.Errorf("getting cropRight: %v", err)
+	}
+	bottom, err := f.CropBottom.Get()
+	if err != nil {
+		return image.Rectangle{}, fmt.Errorf("getting cropBottom: %v", err)
+	}
+	// Not image.Rect, which would put the corners in order.
+	return image.Rectangle{Min: image.Pt(left, top), Max: image.Pt(right, bottom)}, nil
+}
+
+// SetCropRect sets the crop bindings from r.
+func (f Form) SetCropRect(r image.Rectangle) {
+	for _, v := range []struct {
+		b binding.Int
+		n int
+	}{
+		{f.CropLeft, r.Min.X},
+		{f.CropTop, r.Min.Y},
+		{f.CropRight, r.Max.X},
+		{f.CropBottom, r.Max.Y},
+	} {
+		err := v.b.Set(v.n)
+		if err != nil {
+			fmt.Println("Error setting crop: ", err)
+		}
+	}
+}
+
+// StartCropDrag starts dragging the crop from the video point (x, y). If the
+// point is within tolerance (in video pixels) of an edge or corner of the
+// crop, that edge or corner is moved; otherwise a new crop is drawn from the
+// point. Polygons have their nearest vertex moved instead, or a new vertex
+// added if there isn't one within tolerance.
+func (f Form) StartCropDrag(x, y, tolerance float64) {
+	if f.editingPolygon() {
+		f.startVertexDrag(x, y, tolerance)
+		return
+	}
+	r, err := f.CropRect()
+	if err != nil {
+		fmt.Println("Error getting crop: ", err)
+		return
+	}
+	r = r.Canon()
+	near := func(a float64, b int) bool {
+		return math.Abs(a-float64(b)) <= tolerance
+	}
+	within := func(a float64, lo, hi int) bool {
+		return a >= float64(lo)-tolerance && a <= float64(hi)+tolerance
+	}
+	d := cropDrag{
+		left:   near(x, r.Min.X) && within(y, r.Min.Y, r.Max.Y),
+		right:  near(x, r.Max.X) && within(y, r.Min.Y, r.Max.Y),
+		top:    near(y, r.Min.Y) && within(x, r.Min.X, r.Max.X),
+		bottom: near(y, r.Max.Y) && within(x, r.Min.X, r.Max.X),
+	}
+	// On a very small crop, move whichever edge is closer.
+	if d.left && d.right {
+		d.left = math.Abs(x-float64(r.Min.X)) < math.Abs(x-float64(r.Max.X))
+		d.right = !d.left
+	}
+	if d.top && d.bottom {
+		d.top = math.Abs(y-float64(r.Min.Y)) < math.Abs(y-float64(r.Max.Y))
+		d.bottom = !d.top
+	}
+	if !d.left && !d.right && !d.top && !d.bottom {
+		p := f.clampPoint(x, y)
+		r = image.Rectangle{Min: p, Max: p}
+		d = cropDrag{right: true, bottom: true}
+	}
+	d.vertex = -1
+	f.crops.mu.Lock()
+	f.crops.drag = d
+	f.crops.mu.Unlock()
+	f.SetCropRect(r)
+}
+
+func (f Form) startVertexDrag(x, y, tolerance float64) {
+	f.crops.mu.Lock()
+	c := &f.crops.list[f.crops.selected]
+	vertex := -1
+	best := tolerance
+	for i, p := range c.Points {
+		if d := math.Hypot(x-float64(p.X), y-float64(p.Y)); d <= best {
+			vertex = i
+			best = d
+		}
+	}
+	if vertex < 0 {
+		c.Points = append(c.Points, f.clampPoint(x, y))
+		vertex = len(c.Points) - 1
+	}
+	f.crops.drag = cropDrag{vertex: vertex}
+	f.crops.mu.Unlock()
+	f.cropsUpdated()
+}
+
+// CropDragTo moves the edges or vertex being dragged to the video point
+// (x, y).
+func (f Form) CropDragTo(x, y float64) {
+	p := f.clampPoint(x, y)
+	f.crops.mu.Lock()
+	d := f.crops.drag
+	if d.vertex >= 0 {
+		f.crops.list[f.crops.selected].Points[d.vertex] = p
+		f.crops.mu.Unlock()
+		f.cropsUpdated()
+		return
+	}
+	f.crops.mu.Unlock()
+	r, err := f.CropRect()
+	if err != nil {
+		fmt.Println("Error getting crop: ", err)
+		return
+	}
+	if d.left {
+		r.Min.X = p.X
+	}
+	if d.right {
+		r.Max.X = p.X
+	}
+	if d.top {
+		r.Min.Y = p.Y
+	}
+	if d.bottom {
+		r.Max.Y = p.Y
+	}
+	f.SetCropRect(r)
+}
+
+// EndCropDrag puts the crop's edges back in order, in case they were dragged
+// past each other.
+func (f Form) EndCropDrag() {
+	f.crops.mu.Lock()
+	f.crops.drag = cropDrag{vertex: -1}
+	f.crops.mu.Unlock()
+	r, err := f.CropRect()
+	if err != nil {
+		fmt.Println("Error getting crop: ", err)
+		return
+	}
+	f.SetCropRect(r.Canon())
+}
+
+func (f Form) clampPoint(x, y float64) image.Point {
+	return image.Pt(
+		utils.ClampInt(int(math.Round(x)), 0, f.VideoWidth),
+		utils.ClampInt(int(math.Round(y)), 0, f.VideoHeight),
+	)
+}
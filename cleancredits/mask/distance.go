@@ -0,0 +1,52 @@
+package mask
+
+import (
+	"fmt"
+	"image/color"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+)
+
+const (
+	MethodRange    = "Color range"
+	MethodDistance = "Color distance"
+)
+
+const (
+	DefaultDeltaE = 10
+	MaxDeltaE     = 100
+)
+
+// swatchSize is the width of each reference color shown in the form.
+const swatchSize = 20
+
+// SetReferenceColors replaces the colors that the distance method selects.
+func (f Form) SetReferenceColors(refs []color.RGBA) {
+	err := f.ReferenceColors.Set(refs)
+	if err != nil {
+		fmt.Println("Error setting ReferenceColors: ", err)
+	}
+}
+
+// ClearReferenceColors removes every reference color.
+func (f Form) ClearReferenceColors() {
+	f.SetReferenceColors(nil)
+}
+
+// updateSwatches shows the reference colors.
+func (f Form) updateSwatches() {
+	refs, err := f.ReferenceColors.Get()
+	if err != nil {
+		fmt.Println("Error getting ReferenceColors: ", err)
+		return
+	}
+	objects := make([]fyne.CanvasObject, len(refs))
+	for i, c := range refs {
+		r := canvas.NewRectangle(c)
+		r.SetMinSize(fyne.NewSquareSize(swatchSize))
+		objects[i] = r
+	}
+	f.swatches.Objects = objects
+	f.swatches.Refresh()
+}
@@ -0,0 +1,32 @@
+package mask
+
+import (
+	"fmt"
+
+	"github.com/sandalwoodbox/go-cleancredits/cleancredits/settings"
+)
+
+const (
+	SampleReplace  = "Replace"
+	SampleAdd      = "Add"
+	SampleSubtract = "Subtract"
+)
+
+const (
+	DefaultTolerance = 5
+	MaxTolerance     = 50
+)
+
+// SetRanges sets the color ranges from ms.
+func (f Form) SetRanges(ms settings.Mask) {
+	for i, r := range f.ranges() {
+		err := r[0].Set(ms.Min[i])
+		if err != nil {
+			fmt.Println("Error setting color range: ", err)
+		}
+		err = r[1].Set(ms.Max[i])
+		if err != nil {
+			fmt.Println("Error setting color range: ", err)
+		}
+	}
+}
@@ -2,6 +2,8 @@ package mask
 
 import (
 	"fmt"
+	"image/color"
+	"slices"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/container"
@@ -25,58 +27,137 @@ const (
 )
 
 type Form struct {
-	Container *fyne.Container
+	Container   *fyne.Container
+	VideoWidth  int
+	VideoHeight int
 
 	Frame binding.Int
 	Mode  binding.String // TODO: implement this more fully - it's the mode of the current mask
 	Grow  binding.Int
+	// Shrink, Open and Close are applied before Grow, all with a Kernel
+	// shaped kernel.
+	Shrink binding.Int
+	Open   binding.Int
+	Close  binding.Int
+	Kernel binding.String
 
-	HueMin binding.Int
-	HueMax binding.Int
-	SatMin binding.Int
-	SatMax binding.Int
-	ValMin binding.Int
-	ValMax binding.Int
+	// Method is how pixels are selected: by the color ranges, or by their
+	// distance from ReferenceColors.
+	Method          binding.String
+	ReferenceColors binding.List[color.RGBA]
+	DeltaE          binding.Int
 
+	// MinArea, MaxArea, MinAspect, MaxAspect, MinSolidity and MaxSolidity
+	// filter the connected components of the selection. Zero means no limit.
+	MinArea     binding.Int
+	MaxArea     binding.Int
+	MinAspect   binding.Float
+	MaxAspect   binding.Float
+	MinSolidity binding.Int
+	MaxSolidity binding.Int
+
+	// ColorSpace is what the ranges below select from.
+	ColorSpace binding.String
+
+	// Min and Max are the ranges of each channel of ColorSpace.
+	Min [3]binding.Int
+	Max [3]binding.Int
+
+	// CropShape and CropLeft, CropTop, CropRight and CropBottom edit the
+	// selected crop region. Polygons ignore the bounds.
+	CropShape  binding.String
 	CropLeft   binding.Int
 	CropTop    binding.Int
 	CropRight  binding.Int
 	CropBottom binding.Int
+
+	// Tool is what dragging on the preview does while the Mask tab is open.
+	Tool binding.String
+	// SampleMode and Tolerance control how the eyedropper changes the color
+	// ranges.
+	SampleMode binding.String
+	Tolerance  binding.Int
+
+	crops        *cropRegions
+	cropsChanged binding.Int
+	channels     *channelControls
+	swatches     *fyne.Container
 }
 
 func NewForm(frameCount, videoWidth, videoHeight int) Form {
 	f := Form{
+		VideoWidth:  videoWidth,
+		VideoHeight: videoHeight,
+
 		Frame: binding.NewInt(),
 		Mode:  binding.NewString(),
 
-		HueMin: binding.NewInt(),
-		HueMax: binding.NewInt(),
-		SatMin: binding.NewInt(),
-		SatMax: binding.NewInt(),
-		ValMin: binding.NewInt(),
-		ValMax: binding.NewInt(),
+		Method:          binding.NewString(),
+		ReferenceColors: binding.NewList(func(a, b color.RGBA) bool { return a == b }),
+		DeltaE:          binding.NewInt(),
+
+		MinArea:     binding.NewInt(),
+		MaxArea:     binding.NewInt(),
+		MinAspect:   binding.NewFloat(),
+		MaxAspect:   binding.NewFloat(),
+		MinSolidity: binding.NewInt(),
+		MaxSolidity: binding.NewInt(),
+
+		ColorSpace: binding.NewString(),
+
 		Grow:   binding.NewInt(),
+		Shrink: binding.NewInt(),
+		Open:   binding.NewInt(),
+		Close:  binding.NewInt(),
+		Kernel: binding.NewString(),
 
+		CropShape:  binding.NewString(),
 		CropLeft:   binding.NewInt(),
 		CropTop:    binding.NewInt(),
 		CropRight:  binding.NewInt(),
 		CropBottom: binding.NewInt(),
+
+		Tool:       binding.NewString(),
+		SampleMode: binding.NewString(),
+		Tolerance:  binding.NewInt(),
+
+		crops:        &cropRegions{drag: cropDrag{vertex: -1}},
+		cropsChanged: binding.NewInt(),
 	}
+	for i := range f.Min {
+		f.Min[i] = binding.NewInt()
+		f.Max[i] = binding.NewInt()
+	}
+	f.crops.list = []settings.Crop{f.fullFrameCrop()}
 	err := f.Mode.Set(Include)
 	if err != nil {
 		fmt.Println("Error setting Mode: ", err)
 	}
-	err = f.HueMax.Set(HueMax)
+	err = f.Method.Set(MethodRange)
+	if err != nil {
+		fmt.Println("Error setting Method: ", err)
+	}
+	err = f.DeltaE.Set(DefaultDeltaE)
 	if err != nil {
-		fmt.Println("Error setting HueMax: ", err)
+		fmt.Println("Error setting DeltaE: ", err)
 	}
-	err = f.SatMax.Set(SatMax)
+	err = f.ColorSpace.Set(ColorSpaceHSV)
 	if err != nil {
-		fmt.Println("Error setting SatMax: ", err)
+		fmt.Println("Error setting ColorSpace: ", err)
 	}
-	err = f.ValMax.Set(ValMax)
+	for i, v := range ColorSpaceChannels(ColorSpaceHSV).Max {
+		err = f.Max[i].Set(v)
+		if err != nil {
+			fmt.Println("Error setting Max: ", err)
+		}
+	}
+	err = f.Kernel.Set(KernelRectangle)
+	if err != nil {
+		fmt.Println("Error setting Kernel: ", err)
+	}
+	err = f.CropShape.Set(CropRectangle)
 	if err != nil {
-		fmt.Println("Error setting ValMax: ", err)
+		fmt.Println("Error setting CropShape: ", err)
 	}
 	err = f.CropRight.Set(videoWidth)
 	if err != nil {
@@ -86,27 +167,78 @@ func NewForm(frameCount, videoWidth, videoHeight int) Form {
 	if err != nil {
 		fmt.Println("Error setting CropBottom: ", err)
 	}
+	err = f.Tool.Set(ToolPan)
+	if err != nil {
+		fmt.Println("Error setting Tool: ", err)
+	}
+	err = f.SampleMode.Set(SampleReplace)
+	if err != nil {
+		fmt.Println("Error setting SampleMode: ", err)
+	}
+	err = f.Tolerance.Set(DefaultTolerance)
+	if err != nil {
+		fmt.Println("Error setting Tolerance: ", err)
+	}
+	f.crops.selector = widget.NewSelect(nil, func(string) {
+		f.SelectCrop(f.crops.selector.SelectedIndex())
+	})
+	f.cropsUpdated()
+	f.CropShape.AddListener(binding.NewDataListener(f.shapeChanged))
+	f.swatches = container.NewHBox()
+	f.ReferenceColors.AddListener(binding.NewDataListener(f.updateSwatches))
+	f.channels = f.newChannelControls()
+	f.ColorSpace.AddListener(binding.NewDataListener(f.colorSpaceChanged))
+	// Redraw every channel's gradient when any of the ranges change, since
+	// each gradient depends on the other channels.
+	gradientListener := binding.NewDataListener(f.updateGradients)
+	f.ColorSpace.AddListener(gradientListener)
+	for _, r := range f.ranges() {
+		r[0].AddListener(gradientListener)
+		r[1].AddListener(gradientListener)
+	}
+	rows := []fyne.CanvasObject{
+		widget.NewLabel("Frame"), ccWidget.NewIntSliderWithData(0, frameCount-1, f.Frame), ccWidget.NewIntEntryWithData(0, frameCount-1, f.Frame),
+		// With the crop tool, drag on the preview to draw the crop or move its edges.
+		widget.NewLabel("Tool"), widget.NewSelectWithData([]string{ToolPan, ToolCrop, ToolEyedropper}, f.Tool), widget.NewLabel(""),
+
+		// The eyedropper picks reference colors for the distance method.
+		widget.NewLabel("Method"), widget.NewSelectWithData([]string{MethodRange, MethodDistance}, f.Method), widget.NewLabel(""),
+		widget.NewLabel("Delta E"), ccWidget.NewIntSliderWithData(0, MaxDeltaE, f.DeltaE), ccWidget.NewIntEntryWithData(0, MaxDeltaE, f.DeltaE),
+		widget.NewLabel("Colors"), f.swatches, widget.NewButton("Clear", f.ClearReferenceColors),
+		// Changing the color space relabels the range controls below.
+		widget.NewLabel("Color space"), widget.NewSelectWithData(ColorSpaces, f.ColorSpace), widget.NewLabel(""),
+		// With the eyedropper, click or drag a box on the preview to sample colors.
+		widget.NewLabel("Sample"), widget.NewSelectWithData([]string{SampleReplace, SampleAdd, SampleSubtract}, f.SampleMode), widget.NewLabel(""),
+		widget.NewLabel("Tolerance"), ccWidget.NewIntSliderWithData(0, MaxTolerance, f.Tolerance), ccWidget.NewIntEntryWithData(0, MaxTolerance, f.Tolerance),
+	}
+	rows = append(rows, f.channels.rows()...)
+	rows = append(rows,
+		// Only connected components within these limits are kept; 0 means no limit.
+		widget.NewLabel("Area"), ccWidget.NewIntEntryWithData(0, videoWidth*videoHeight, f.MinArea), ccWidget.NewIntEntryWithData(0, videoWidth*videoHeight, f.MaxArea),
+		widget.NewLabel("Aspect ratio"), widget.NewEntryWithData(binding.FloatToString(f.MinAspect)), widget.NewEntryWithData(binding.FloatToString(f.MaxAspect)),
+		widget.NewLabel("Solidity %"), ccWidget.NewIntEntryWithData(0, 100, f.MinSolidity), ccWidget.NewIntEntryWithData(0, 100, f.MaxSolidity),
+		// Open removes specks and Close fills gaps inside letters.
+		widget.NewLabel("Open"), ccWidget.NewIntSliderWithData(0, MaxMorphology, f.Open), ccWidget.NewIntEntryWithData(0, MaxMorphology, f.Open),
+		widget.NewLabel("Close"), ccWidget.NewIntSliderWithData(0, MaxMorphology, f.Close), ccWidget.NewIntEntryWithData(0, MaxMorphology, f.Close),
+		widget.NewLabel("Shrink"), ccWidget.NewIntSliderWithData(0, MaxMorphology, f.Shrink), ccWidget.NewIntEntryWithData(0, MaxMorphology, f.Shrink),
+		widget.NewLabel("Grow"), ccWidget.NewIntSliderWithData(0, MaxMorphology, f.Grow), ccWidget.NewIntEntryWithData(0, MaxMorphology, f.Grow),
+		widget.NewLabel("Kernel"), widget.NewSelectWithData(KernelShapes, f.Kernel), widget.NewLabel(""),
+
+		// The mask is limited to the union of the crop regions.
+		widget.NewLabel("Crop"), f.crops.selector, container.NewGridWithColumns(2,
+			widget.NewButton("Add", f.AddCrop),
+			widget.NewButton("Remove", f.RemoveCrop),
+		),
+		// With the crop tool, click on the preview to add a polygon's vertices.
+		widget.NewLabel("Shape"), widget.NewSelectWithData(CropShapes, f.CropShape), widget.NewButton("Clear points", f.ClearCropPoints),
+		widget.NewLabel("Left"), ccWidget.NewIntSliderWithData(0, videoWidth, f.CropLeft), ccWidget.NewIntEntryWithData(0, videoWidth, f.CropLeft),
+		widget.NewLabel("Top"), ccWidget.NewIntSliderWithData(0, videoHeight, f.CropTop), ccWidget.NewIntEntryWithData(0, videoHeight, f.CropTop),
+		widget.NewLabel("Right"), ccWidget.NewIntSliderWithData(0, videoWidth, f.CropRight), ccWidget.NewIntEntryWithData(0, videoWidth, f.CropRight),
+		widget.NewLabel("Bottom"), ccWidget.NewIntSliderWithData(0, videoHeight, f.CropBottom), ccWidget.NewIntEntryWithData(0, videoHeight, f.CropBottom),
+	)
 	f.Container = container.New(
 		layout.NewVBoxLayout(),
-		container.New(
-			layout.NewGridLayout(3),
-			widget.NewLabel("Frame"), ccWidget.NewIntSliderWithData(0, frameCount-1, f.Frame), ccWidget.NewIntEntryWithData(0, frameCount-1, f.Frame),
-
-			widget.NewLabel("Hue / Saturation / Value"), widget.NewLabel(""), widget.NewLabel(""),
-			widget.NewLabel("Hue Min"), ccWidget.NewIntSliderWithData(0, HueMax, f.HueMin), ccWidget.NewIntEntryWithData(0, HueMax, f.HueMin),
-			widget.NewLabel("Hue Max"), ccWidget.NewIntSliderWithData(0, HueMax, f.HueMax), ccWidget.NewIntEntryWithData(0, HueMax, f.HueMax),
-			widget.NewLabel("Sat Min"), ccWidget.NewIntSliderWithData(0, SatMax, f.SatMin), ccWidget.NewIntEntryWithData(0, SatMax, f.SatMin),
-			widget.NewLabel("Sat Max"), ccWidget.NewIntSliderWithData(0, SatMax, f.SatMax), ccWidget.NewIntEntryWithData(0, SatMax, f.SatMax),
-			widget.NewLabel("Val Min"), ccWidget.NewIntSliderWithData(0, ValMax, f.ValMin), ccWidget.NewIntEntryWithData(0, ValMax, f.ValMin),
-			widget.NewLabel("Val Max"), ccWidget.NewIntSliderWithData(0, ValMax, f.ValMax), ccWidget.NewIntEntryWithData(0, ValMax, f.ValMax),
-			widget.NewLabel("Grow"), ccWidget.NewIntSliderWithData(0, 20, f.Grow), ccWidget.NewIntEntryWithData(0, 20, f.Grow),
-
-			widget.NewLabel("Crop"), widget.NewLabel(""), widget.NewLabel(""),
-			widget.NewLabel("Left"), ccWidget.NewIntSliderWithData(0, videoWidth, f.CropLeft), ccWidget.NewIntEntryWithData(0, videoWidth, f.CropLeft),
-			widget.NewLabel("Top"), ccWidget.NewIntSliderWithData(0, videoHeight, f.CropTop), ccWidget.NewIntEntryWithData(0, videoHeight, f.CropTop),
-			widget.NewLabel("Right"), ccWidget.NewIntSliderWithData(0, videoWidth, f.CropRight), ccWidget.NewIntEntryWithData(0, videoWidth, f.CropRight),
-			widget.NewLabel("Bottom"), ccWidget.NewIntSliderWithData(0, videoHeight, f.CropBottom), ccWidget.NewIntEntryWithData(0, videoHeight, f.CropBottom),
-		),
+		container.New(layout.NewGridLayout(3), rows...),
 	)
 	return f
 }
@@ -115,18 +247,38 @@ func (f Form) OnChange(fn func()) {
 	l := binding.NewDataListener(fn)
 	f.Frame.AddListener(l)
 	f.Grow.AddListener(l)
+	f.Shrink.AddListener(l)
+	f.Open.AddListener(l)
+	f.Close.AddListener(l)
+	f.Kernel.AddListener(l)
 
-	f.HueMin.AddListener(l)
-	f.HueMax.AddListener(l)
-	f.SatMin.AddListener(l)
-	f.SatMax.AddListener(l)
-	f.ValMin.AddListener(l)
-	f.ValMax.AddListener(l)
+	f.Method.AddListener(l)
+	f.ReferenceColors.AddListener(l)
+	f.DeltaE.AddListener(l)
+	f.MinArea.AddListener(l)
+	f.MaxArea.AddListener(l)
+	f.MinAspect.AddListener(l)
+	f.MaxAspect.AddListener(l)
+	f.MinSolidity.AddListener(l)
+	f.MaxSolidity.AddListener(l)
+	f.ColorSpace.AddListener(l)
+	for i := range f.Min {
+		f.Min[i].AddListener(l)
+		f.Max[i].AddListener(l)
+	}
 
+	f.OnCropChange(fn)
+}
+
+// OnCropChange calls fn whenever any of the crop regions change.
+func (f Form) OnCropChange(fn func()) {
+	l := binding.NewDataListener(fn)
+	f.CropShape.AddListener(l)
 	f.CropLeft.AddListener(l)
 	f.CropTop.AddListener(l)
 	f.CropRight.AddListener(l)
 	f.CropBottom.AddListener(l)
+	f.cropsChanged.AddListener(l)
 }
 
 func (f Form) Settings() (settings.Mask, error) {
@@ -139,35 +291,78 @@ func (f Form) Settings() (settings.Mask, error) {
 		return settings.Mask{}, fmt.Errorf("getting mask mode: %v", err)
 	}
 
-	hueMin, err := f.HueMin.Get()
+	method, err := f.Method.Get()
+	if err != nil {
+		return settings.Mask{}, fmt.Errorf("getting method: %v", err)
+	}
+	refs, err := f.ReferenceColors.Get()
+	if err != nil {
+		return settings.Mask{}, fmt.Errorf("getting reference colors: %v", err)
+	}
+	deltaE, err := f.DeltaE.Get()
+	if err != nil {
+		return settings.Mask{}, fmt.Errorf("getting delta e: %v", err)
+	}
+	minArea, err := f.MinArea.Get()
+	if err != nil {
+		return settings.Mask{}, fmt.Errorf("getting min area: %v", err)
+	}
+	maxArea, err := f.MaxArea.Get()
 	if err != nil {
-		return settings.Mask{}, fmt.Errorf("getting hue min: %v", err)
+		return settings.Mask{}, fmt.Errorf("getting max area: %v", err)
 	}
-	hueMax, err := f.HueMax.Get()
+	minAspect, err := f.MinAspect.Get()
 	if err != nil {
-		return settings.Mask{}, fmt.Errorf("getting hue max: %v", err)
+		return settings.Mask{}, fmt.Errorf("getting min aspect: %v", err)
 	}
-	satMin, err := f.SatMin.Get()
+	maxAspect, err := f.MaxAspect.Get()
 	if err != nil {
-		return settings.Mask{}, fmt.Errorf("getting sat min: %v", err)
+		return settings.Mask{}, fmt.Errorf("getting max aspect: %v", err)
 	}
-	satMax, err := f.SatMax.Get()
+	minSolidity, err := f.MinSolidity.Get()
 	if err != nil {
-		return settings.Mask{}, fmt.Errorf("getting sat max: %v", err)
+		return settings.Mask{}, fmt.Errorf("getting min solidity: %v", err)
 	}
-	valMin, err := f.ValMin.Get()
+	maxSolidity, err := f.MaxSolidity.Get()
 	if err != nil {
-		return settings.Mask{}, fmt.Errorf("getting val min: %v", err)
+		return settings.Mask{}, fmt.Errorf("getting max solidity: %v", err)
 	}
-	valMax, err := f.ValMax.Get()
+	colorSpace, err := f.ColorSpace.Get()
 	if err != nil {
-		return settings.Mask{}, fmt.Errorf("getting val max: %v", err)
+		return settings.Mask{}, fmt.Errorf("getting color space: %v", err)
+	}
+	var mins, maxes [3]int
+	for i := range f.Min {
+		mins[i], err = f.Min[i].Get()
+		if err != nil {
+			return settings.Mask{}, fmt.Errorf("getting channel %d min: %v", i, err)
+		}
+		maxes[i], err = f.Max[i].Get()
+		if err != nil {
+			return settings.Mask{}, fmt.Errorf("getting channel %d max: %v", i, err)
+		}
 	}
 
 	grow, err := f.Grow.Get()
 	if err != nil {
 		return settings.Mask{}, fmt.Errorf("getting grow: %v", err)
 	}
+	shrink, err := f.Shrink.Get()
+	if err != nil {
+		return settings.Mask{}, fmt.Errorf("getting shrink: %v", err)
+	}
+	open, err := f.Open.Get()
+	if err != nil {
+		return settings.Mask{}, fmt.Errorf("getting open: %v", err)
+	}
+	closeSize, err := f.Close.Get()
+	if err != nil {
+		return settings.Mask{}, fmt.Errorf("getting close: %v", err)
+	}
+	kernel, err := f.Kernel.Get()
+	if err != nil {
+		return settings.Mask{}, fmt.Errorf("getting kernel: %v", err)
+	}
 	cropLeft, err := f.CropLeft.Get()
 	if err != nil {
 		return settings.Mask{}, fmt.Errorf("getting cropLeft: %v", err)
@@ -184,19 +379,37 @@ func (f Form) Settings() (settings.Mask, error) {
 	if err != nil {
 		return settings.Mask{}, fmt.Errorf("getting cropBottom: %v", err)
 	}
+	crops, err := f.Crops()
+	if err != nil {
+		return settings.Mask{}, fmt.Errorf("getting crops: %v", err)
+	}
 	return settings.Mask{
 		Frame:      frame,
 		Mode:       mode,
-		HueMin:     hueMin,
-		HueMax:     hueMax,
-		SatMin:     satMin,
-		SatMax:     satMax,
-		ValMin:     valMin,
-		ValMax:     valMax,
+		Method:     method,
+		ColorSpace: colorSpace,
+		Min:        mins,
+		Max:        maxes,
 		Grow:       grow,
+		Shrink:     shrink,
+		Open:       open,
+		Close:      closeSize,
+		Kernel:     kernel,
+
+		ReferenceColors: slices.Clone(refs),
+		DeltaE:          deltaE,
+
+		MinArea:     minArea,
+		MaxArea:     maxArea,
+		MinAspect:   minAspect,
+		MaxAspect:   maxAspect,
+		MinSolidity: minSolidity,
+		MaxSolidity: maxSolidity,
+
 		CropLeft:   cropLeft,
 		CropTop:    cropTop,
 		CropRight:  cropRight,
 		CropBottom: cropBottom,
+		Crops:      crops,
 	}, nil
 }
@@ -0,0 +1,136 @@
+package mask
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+)
+
+// ChannelColor returns the color with the given 8 bit channel values in
+// colorSpace, using the same scales as OpenCV.
+func ChannelColor(colorSpace string, v [3]int) color.RGBA {
+	var r, g, b float64
+	switch colorSpace {
+	case ColorSpaceHLS:
+		r, g, b = hlsToRGB(float64(v[0])*2, float64(v[1])/255, float64(v[2])/255)
+	case ColorSpaceLab:
+		r, g, b = labToRGB(float64(v[0])*100/255, float64(v[1]-128), float64(v[2]-128))
+	case ColorSpaceYCrCb:
+		y, cr, cb := float64(v[0]), float64(v[1]-128), float64(v[2]-128)
+		r = (y + 1.403*cr) / 255
+		g = (y - 0.714*cr - 0.344*cb) / 255
+		b = (y + 1.773*cb) / 255
+	case ColorSpaceRGB:
+		r, g, b = float64(v[0])/255, float64(v[1])/255, float64(v[2])/255
+	default: // ColorSpaceHSV
+		r, g, b = hsvToRGB(float64(v[0])*2, float64(v[1])/255, float64(v[2])/255)
+	}
+	return color.RGBA{R: toByte(r), G: toByte(g), B: toByte(b), A: 255}
+}
+
+func toByte(f float64) uint8 {
+	return uint8(math.Round(math.Min(math.Max(f, 0), 1) * 255))
+}
+
+// hueToRGB returns the fully saturated color with hue h in degrees.
+func hueToRGB(h float64) (r, g, b float64) {
+	h = math.Mod(h, 360) / 60
+	x := 1 - math.Abs(math.Mod(h, 2)-1)
+	switch int(h) {
+	case 0:
+		return 1, x, 0
+	case 1:
+		return x, 1, 0
+	case 2:
+		return 0, 1, x
+	case 3:
+		return 0, x, 1
+	case 4:
+		return x, 0, 1
+	default:
+		return 1, 0, x
+	}
+}
+
+func hsvToRGB(h, s, v float64) (r, g, b float64) {
+	r, g, b = hueToRGB(h)
+	c := v * s
+	m := v - c
+	return r*c + m, g*c + m, b*c + m
+}
+
+func hlsToRGB(h, l, s float64) (r, g, b float64) {
+	r, g, b = hueToRGB(h)
+	c := (1 - math.Abs(2*l-1)) * s
+	m := l - c/2
+	return r*c + m, g*c + m, b*c + m
+}
+
+// labToRGB converts CIE Lab (D65) to sRGB.
+func labToRGB(l, a, bb float64) (r, g, b float64) {
+	fy := (l + 16) / 116
+	fx := fy + a/500
+	fz := fy - bb/200
+	finv := func(t float64) float64 {
+		if t > 6.0/29 {
+			return t * t * t
+		}
+		return 3 * (6.0 / 29) * (6.0 / 29) * (t - 4.0/29)
+	}
+	x := 0.950456 * finv(fx)
+	y := finv(fy)
+	z := 1.088754 * finv(fz)
+	gamma := func(c float64) float64 {
+		if c <= 0.0031308 {
+			return 12.92 * c
+		}
+		return 1.055*math.Pow(c, 1/2.4) - 0.055
+	}
+	r = gamma(3.240479*x - 1.53715*y - 0.498535*z)
+	g = gamma(-0.969256*x + 1.875991*y + 0.041556*z)
+	b = gamma(0.055648*x - 0.204043*y + 1.057311*z)
+	return r, g, b
+}
+
+// midpoint returns the middle of the range lo to hi. For hues, a range with
+// lo greater than hi wraps around past max back to 0.
+func midpoint(lo, hi, max int, hue bool) int {
+	if hue && lo > hi {
+		return (lo + hi + max + 1) / 2 % (max + 1)
+	}
+	return (lo + hi) / 2
+}
+
+// updateGradients shows what each channel's values look like, with the other
+// channels held at the middle of their ranges.
+func (f Form) updateGradients() {
+	space, err := f.ColorSpace.Get()
+	if err != nil {
+		fmt.Println("Error getting ColorSpace: ", err)
+		return
+	}
+	ch := ColorSpaceChannels(space)
+	var mid [3]int
+	for i, r := range f.ranges() {
+		lo, err := r[0].Get()
+		if err != nil {
+			fmt.Println("Error getting color range: ", err)
+			return
+		}
+		hi, err := r[1].Get()
+		if err != nil {
+			fmt.Println("Error getting color range: ", err)
+			return
+		}
+		mid[i] = midpoint(lo, hi, ch.Max[i], ch.Hue && i == 0)
+	}
+	for i := range ch.Max {
+		gradient := make([]color.Color, ch.Max[i]+1)
+		v := mid
+		for n := range gradient {
+			v[i] = n
+			gradient[n] = ChannelColor(space, v)
+		}
+		f.channels.sliders[i].SetGradient(gradient)
+	}
+}
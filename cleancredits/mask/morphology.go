@@ -0,0 +1,13 @@
+package mask
+
+// Kernel shapes for Grow, Shrink, Open and Close.
+const (
+	KernelRectangle = "Rectangle"
+	KernelEllipse   = "Ellipse"
+	KernelCross     = "Cross"
+)
+
+var KernelShapes = []string{KernelRectangle, KernelEllipse, KernelCross}
+
+// MaxMorphology is the largest kernel for Grow, Shrink, Open and Close.
+const MaxMorphology = 20
@@ -8,53 +8,343 @@ import (
 	"gocv.io/x/gocv"
 )
 
+// PrefetchFrames is how many frames ahead of the current frame FrameCache
+// decodes in the background when frames are being loaded in order.
+const PrefetchFrames = 4
+
+// DefaultCacheBytes is the default memory budget for decoded frames.
+const DefaultCacheBytes = 1 << 30
+
+// CacheOptions controls how many decoded frames FrameCache keeps.
+type CacheOptions struct {
+	// MemoryBytes is the memory budget for decoded frames. The cache always
+	// holds enough frames for the current frame and those being prefetched,
+	// even if that exceeds the budget.
+	MemoryBytes int64
+	// DiskBytes is how much disk space may be used to keep frames in the
+	// active range (see SetActiveRange) after they have been evicted from
+	// memory. 0 disables the disk cache.
+	DiskBytes int64
+}
+
+// DefaultCacheOptions are used when no preferences are available.
+var DefaultCacheOptions = CacheOptions{MemoryBytes: DefaultCacheBytes}
+
+// CacheStats counts how FrameCache has satisfied requests for frames.
+type CacheStats struct {
+	// Hits and Misses count calls to LoadFrame.
+	Hits   int
+	Misses int
+	// Prefetched counts frames decoded in the background.
+	Prefetched int
+	// Seeks counts decodes that couldn't read on from the current position.
+	Seeks int
+	// DiskHits counts misses that were loaded from the disk cache.
+	DiskHits int
+}
+
+func (s CacheStats) String() string {
+	return fmt.Sprintf("%d hits, %d misses, %d prefetched, %d seeks, %d disk hits", s.Hits, s.Misses, s.Prefetched, s.Seeks, s.DiskHits)
+}
+
 // FrameCache allows caching recently loaded frames and also controls locking
 // for the VideoCapture to avoid contention between threads.
 type FrameCache struct {
-	vc     *gocv.VideoCapture
+	vc     Capture
+	index  *SeekIndex
 	locker *sync.Mutex
 	cache  *lru.Cache[int, gocv.Mat]
-	debug  bool
+	// spill is nil if the disk cache is disabled.
+	spill *spillCache
+	// evicted are frames that have been evicted from memory and are waiting
+	// to be written to the disk cache, which is done without holding locker.
+	evicted []evictedFrame
+	debug   bool
+
+	// pos is the frame that the next vc.Read will return, or -1 if unknown.
+	pos int
+	// last is the frame most recently passed to LoadFrame.
+	last int
+	// prefetchGen is incremented to stop earlier prefetches.
+	prefetchGen int
+	stats       CacheStats
 }
 
-func NewFrameCache(vc *gocv.VideoCapture, debug bool) (*FrameCache, error) {
-	cache, err := lru.NewWithEvict(10, func(k int, v gocv.Mat) {
+// NewFrameCache returns a FrameCache that loads frames from vc. If index is
+// non-nil, it is used to guarantee that seeks land on the exact frame.
+func NewFrameCache(vc Capture, index *SeekIndex, opts CacheOptions, debug bool) (*FrameCache, error) {
+	fc := &FrameCache{
+		vc:     vc,
+		index:  index,
+		locker: &sync.Mutex{},
+		debug:  debug,
+		pos:    -1,
+		last:   -2,
+	}
+	if opts.DiskBytes > 0 {
+		fc.spill = newSpillCache(opts.DiskBytes)
+	}
+	size := CacheSize(opts.MemoryBytes, int(vc.Get(gocv.VideoCaptureFrameWidth)), int(vc.Get(gocv.VideoCaptureFrameHeight)))
+	cache, err := lru.NewWithEvict(size, func(k int, v gocv.Mat) {
 		if debug {
 			fmt.Printf("Evicted frame %d. Ptr: %v", k, v.Ptr())
 		}
+		// Evictions happen inside cache.Add, so fc.locker is already held.
+		if fc.spill != nil {
+			fc.evicted = append(fc.evicted, evictedFrame{n: k, mat: v})
+			return
+		}
 		v.Close()
 	})
 	if err != nil {
 		return nil, fmt.Errorf("creating cache: %v", err)
 	}
-	return &FrameCache{
-		vc:     vc,
-		locker: &sync.Mutex{},
-		cache:  cache,
-		debug:  debug,
-	}, nil
+	fc.cache = cache
+	return fc, nil
+}
+
+type evictedFrame struct {
+	n   int
+	mat gocv.Mat
+}
+
+// CacheSize returns how many BGR frames of the given dimensions fit in
+// budget bytes.
+func CacheSize(budget int64, width, height int) int {
+	// The frame being displayed, the frames being prefetched, and one more
+	// so that a prefetch can't evict the frame that was just loaded.
+	minSize := PrefetchFrames + 2
+	frameBytes := int64(width) * int64(height) * 3
+	if frameBytes <= 0 {
+		return minSize
+	}
+	return int(max(budget/frameBytes, int64(minSize)))
 }
 
+// LoadFrame returns a copy of frame n, which the caller must close. The
+// cached Mats are closed when they are evicted, which can happen at any time
+// (for example when a prefetch adds a frame), so they are never handed out.
 func (fc *FrameCache) LoadFrame(n int) (gocv.Mat, error) {
+	// Deferred calls run in reverse, so this runs after locker is released.
+	defer fc.spillEvicted()
 	fc.locker.Lock()
+	defer fc.locker.Unlock()
+	sequential := n == fc.last+1
+	fc.last = n
 	mat, ok := fc.cache.Get(n)
-	if !ok {
-		mat = gocv.NewMat()
+	if ok {
+		fc.stats.Hits++
+		if fc.debug {
+			fmt.Printf("Loaded frame %d. Ptr: %v\n", n, mat.Ptr())
+		}
+	} else {
+		fc.stats.Misses++
+		var err error
+		mat, err = fc.loadMissing(n)
+		if err != nil {
+			return gocv.NewMat(), err
+		}
+		fc.cache.Add(n, mat)
+		if fc.debug {
+			fmt.Printf("Added frame %d. Ptr: %v\n", n, mat.Ptr())
+		}
+	}
+	if sequential {
+		fc.prefetchGen++
+		go fc.prefetch(fc.prefetchGen, n+1)
+	}
+	return mat.Clone(), nil
+}
+
+// spillEvicted writes the frames that have been evicted from memory to the
+// disk cache, and closes them. locker must not be held.
+func (fc *FrameCache) spillEvicted() {
+	fc.locker.Lock()
+	evicted := fc.evicted
+	fc.evicted = nil
+	fc.locker.Unlock()
+	for _, e := range evicted {
+		err := fc.spill.Put(e.n, e.mat)
+		if err != nil {
+			fmt.Println("Error writing frame to disk cache: ", err)
+		}
+		e.mat.Close()
+	}
+}
+
+// loadMissing loads a frame that isn't in memory, from the disk cache if
+// possible.
+func (fc *FrameCache) loadMissing(n int) (gocv.Mat, error) {
+	if fc.spill != nil {
+		mat, ok, err := fc.spill.Get(n)
+		if err != nil {
+			fmt.Println("Error reading frame from disk cache: ", err)
+		}
+		if ok {
+			fc.stats.DiskHits++
+			return mat, nil
+		}
+		mat.Close()
+	}
+	mat := gocv.NewMat()
+	err := fc.readFrame(n, &mat)
+	if err != nil {
+		mat.Close()
+		return gocv.NewMat(), err
+	}
+	return mat, nil
+}
+
+// SetActiveRange sets the (inclusive) range of frames that are kept in the
+// disk cache once evicted from memory, such as the frames being rendered.
+func (fc *FrameCache) SetActiveRange(start, end int) {
+	if fc.spill != nil {
+		fc.spill.SetRange(start, end)
+	}
+}
+
+// Close deletes the disk cache. Frames in memory are left alone, since they
+// may still be in use.
+func (fc *FrameCache) Close() error {
+	if fc.spill == nil {
+		return nil
+	}
+	return fc.spill.Close()
+}
+
+// Stats returns counts of cache hits and misses since the cache was created.
+func (fc *FrameCache) Stats() CacheStats {
+	fc.locker.Lock()
+	defer fc.locker.Unlock()
+	return fc.stats
+}
+
+// prefetch decodes the frames following from into the cache, as long as they
+// can be read without seeking. It stops early if another prefetch starts.
+func (fc *FrameCache) prefetch(gen, from int) {
+	for n := from; n < from+PrefetchFrames; n++ {
+		fc.locker.Lock()
+		if gen != fc.prefetchGen {
+			fc.locker.Unlock()
+			return
+		}
+		if fc.cache.Contains(n) {
+			fc.locker.Unlock()
+			continue
+		}
+		if n != fc.pos {
+			fc.locker.Unlock()
+			return
+		}
+		mat := gocv.NewMat()
+		err := fc.readForward(n, &mat)
+		if err != nil {
+			// Most likely the end of the video.
+			mat.Close()
+			fc.pos = -1
+			fc.locker.Unlock()
+			return
+		}
+		fc.pos = n + 1
+		fc.cache.Add(n, mat)
+		fc.stats.Prefetched++
+		if fc.debug {
+			fmt.Printf("Prefetched frame %d. Ptr: %v\n", n, mat.Ptr())
+		}
+		fc.locker.Unlock()
+		fc.spillEvicted()
+	}
+}
+
+// readFrame decodes frame n into mat, reading on from the decoder's current
+// position when possible rather than seeking.
+func (fc *FrameCache) readFrame(n int, mat *gocv.Mat) error {
+	if fc.pos >= 0 && n >= fc.pos && (n == fc.pos || fc.index != nil && fc.index.KeyframeBefore(n) <= fc.pos) {
+		err := fc.readForward(n, mat)
+		if err == nil {
+			fc.pos = n + 1
+			return nil
+		}
+		if fc.debug {
+			fmt.Printf("Reading forward to frame %d failed (%v); seeking instead\n", n, err)
+		}
+	}
+	fc.pos = -1
+	fc.stats.Seeks++
+	err := fc.seekFrame(n, mat)
+	if err != nil {
+		return err
+	}
+	fc.pos = n + 1
+	return nil
+}
+
+// readForward decodes from the current position up to frame n.
+func (fc *FrameCache) readForward(n int, mat *gocv.Mat) error {
+	if n > fc.pos {
+		err := fc.vc.Grab(n - fc.pos)
+		if err != nil {
+			return err
+		}
+	}
+	if !fc.vc.Read(mat) {
+		return fmt.Errorf("invalid frame number: %d", n)
+	}
+	if fc.index != nil && fc.index.FrameAt(fc.vc.Get(gocv.VideoCapturePosMsec)) != n {
+		return fmt.Errorf("decoder was not at frame %d", fc.pos)
+	}
+	return nil
+}
+
+// seekFrame seeks to frame n and decodes it into mat. Without a seek index,
+// this trusts the capture to seek to the right frame.
+func (fc *FrameCache) seekFrame(n int, mat *gocv.Mat) error {
+	if fc.index == nil {
 		fc.vc.Set(
 			gocv.VideoCapturePosFrames,
 			float64(n),
 		)
-		ok := fc.vc.Read(&mat)
+		ok := fc.vc.Read(mat)
 		if !ok {
-			return gocv.NewMat(), fmt.Errorf("invalid frame number: %d", n)
+			return fmt.Errorf("invalid frame number: %d", n)
+		}
+		return nil
+	}
+
+	if n < 0 || n >= fc.index.FrameCount() {
+		return fmt.Errorf("invalid frame number: %d", n)
+	}
+	// Seek to the keyframe before n and decode forward. The timestamp of
+	// the first decoded frame shows where the seek really landed; if it
+	// overshot, try again from an earlier keyframe.
+	start := fc.index.KeyframeBefore(n)
+	for {
+		fc.vc.Set(gocv.VideoCapturePosFrames, float64(start))
+		ok := fc.vc.Read(mat)
+		if !ok {
+			return fmt.Errorf("reading frame %d", start)
+		}
+		landed := fc.index.FrameAt(fc.vc.Get(gocv.VideoCapturePosMsec))
+		if landed >= 0 && landed <= n {
+			if n-landed > 1 {
+				err := fc.vc.Grab(n - landed - 1)
+				if err != nil {
+					return fmt.Errorf("skipping to frame %d: %v", n, err)
+				}
+			}
+			if landed < n && !fc.vc.Read(mat) {
+				return fmt.Errorf("reading frame %d", n)
+			}
+			if fc.index.FrameAt(fc.vc.Get(gocv.VideoCapturePosMsec)) == n {
+				return nil
+			}
+		}
+		if start == 0 {
+			return fmt.Errorf("unable to seek to frame %d", n)
 		}
-		fc.cache.Add(n, mat)
 		if fc.debug {
-			fmt.Printf("Added frame %d. Ptr: %v\n", n, mat.Ptr())
+			fmt.Printf("Seek to frame %d landed on frame %d; retrying from an earlier keyframe\n", start, landed)
 		}
-	} else if fc.debug {
-		fmt.Printf("Loaded frame %d. Ptr: %v\n", n, mat.Ptr())
+		start = fc.index.KeyframeBefore(start - 1)
 	}
-	fc.locker.Unlock()
-	return mat, nil
 }
@@ -0,0 +1,224 @@
+package pipeline
+
+import (
+	"hash/fnv"
+	"testing"
+
+	"gocv.io/x/gocv"
+
+	"github.com/sandalwoodbox/go-cleancredits/cleancredits/settings"
+)
+
+func hashMat(m gocv.Mat) uint64 {
+	h := fnv.New64a()
+	h.Write(m.ToBytes())
+	return h.Sum64()
+}
+
+// decodeAll decodes every frame of the video at path in order, which gives
+// the ground truth for each frame.
+func decodeAll(t *testing.T, path string) []uint64 {
+	vc, err := gocv.VideoCaptureFile(path)
+	if err != nil {
+		t.Fatalf("Error loading video file: %v", err)
+	}
+	defer vc.Close()
+	var hashes []uint64
+	frame := gocv.NewMat()
+	defer frame.Close()
+	for vc.Read(&frame) {
+		hashes = append(hashes, hashMat(frame))
+	}
+	return hashes
+}
+
+func TestFrameCache_seekIndex(t *testing.T) {
+	src := settings.Source{Path: "testdata/horses-720p.mp4", Kind: SourceVideo}
+	index, err := IndexSource(src)
+	if err != nil {
+		t.Fatalf("Error indexing video: %v", err)
+	}
+	want := decodeAll(t, src.Path)
+	if index.FrameCount() != len(want) {
+		t.Fatalf("index has %d frames, video has %d", index.FrameCount(), len(want))
+	}
+	if index.Keyframes[0] != 0 {
+		t.Errorf("first keyframe is %d, want 0", index.Keyframes[0])
+	}
+
+	seekVC, err := gocv.VideoCaptureFile(src.Path)
+	if err != nil {
+		t.Fatalf("Error loading video file: %v", err)
+	}
+	defer seekVC.Close()
+	fc, err := NewFrameCache(seekVC, index, DefaultCacheOptions, false)
+	if err != nil {
+		t.Fatalf("Error creating frame cache: %v", err)
+	}
+	// Load frames backwards and then jumping around, so that every load has
+	// to seek.
+	var order []int
+	for n := len(want) - 1; n >= 0; n-- {
+		order = append(order, n)
+	}
+	for n := 0; n < len(want); n += 7 {
+		order = append(order, (n*31)%len(want))
+	}
+	for _, n := range order {
+		got, err := fc.LoadFrame(n)
+		if err != nil {
+			t.Fatalf("LoadFrame(%d) returned error: %v", n, err)
+		}
+		if hashMat(got) != want[n] {
+			t.Errorf("LoadFrame(%d) returned the wrong frame", n)
+		}
+		got.Close()
+	}
+
+	_, err = fc.LoadFrame(len(want))
+	if err == nil {
+		t.Errorf("LoadFrame(%d) should fail past the end of the video", len(want))
+	}
+}
+
+func TestFrameCache_sequential(t *testing.T) {
+	src := settings.Source{Path: "testdata/horses-720p.mp4", Kind: SourceVideo}
+	index, err := IndexSource(src)
+	if err != nil {
+		t.Fatalf("Error indexing video: %v", err)
+	}
+	want := decodeAll(t, src.Path)
+
+	vc, err := gocv.VideoCaptureFile(src.Path)
+	if err != nil {
+		t.Fatalf("Error loading video file: %v", err)
+	}
+	defer vc.Close()
+	fc, err := NewFrameCache(vc, index, DefaultCacheOptions, false)
+	if err != nil {
+		t.Fatalf("Error creating frame cache: %v", err)
+	}
+	for n := range want {
+		got, err := fc.LoadFrame(n)
+		if err != nil {
+			t.Fatalf("LoadFrame(%d) returned error: %v", n, err)
+		}
+		if hashMat(got) != want[n] {
+			t.Errorf("LoadFrame(%d) returned the wrong frame", n)
+		}
+		got.Close()
+	}
+	stats := fc.Stats()
+	if stats.Hits+stats.Misses != len(want) {
+		t.Errorf("stats count %d loads, want %d", stats.Hits+stats.Misses, len(want))
+	}
+	// Only the first frame should need a seek; everything else is read on
+	// from the previous frame.
+	if stats.Seeks != 1 {
+		t.Errorf("sequential loads caused %d seeks, want 1 (%v)", stats.Seeks, stats)
+	}
+}
+
+func TestFrameCache_eviction(t *testing.T) {
+	src := settings.Source{Path: "testdata/horses-720p.mp4", Kind: SourceVideo}
+	index, err := IndexSource(src)
+	if err != nil {
+		t.Fatalf("Error indexing video: %v", err)
+	}
+	want := decodeAll(t, src.Path)
+
+	vc, err := gocv.VideoCaptureFile(src.Path)
+	if err != nil {
+		t.Fatalf("Error loading video file: %v", err)
+	}
+	defer vc.Close()
+	// The smallest cache possible, so that prefetching evicts quickly.
+	fc, err := NewFrameCache(vc, index, CacheOptions{MemoryBytes: 1}, false)
+	if err != nil {
+		t.Fatalf("Error creating frame cache: %v", err)
+	}
+	first, err := fc.LoadFrame(0)
+	if err != nil {
+		t.Fatalf("LoadFrame(0) returned error: %v", err)
+	}
+	defer first.Close()
+	size := CacheSize(1, int(vc.Get(gocv.VideoCaptureFrameWidth)), int(vc.Get(gocv.VideoCaptureFrameHeight)))
+	for n := 1; n < 3*size && n < len(want); n++ {
+		got, err := fc.LoadFrame(n)
+		if err != nil {
+			t.Fatalf("LoadFrame(%d) returned error: %v", n, err)
+		}
+		got.Close()
+	}
+	if fc.cache.Contains(0) {
+		t.Fatal("frame 0 wasn't evicted")
+	}
+	if hashMat(first) != want[0] {
+		t.Error("frame 0 changed after it was evicted")
+	}
+}
+
+func TestFrameCache_spill(t *testing.T) {
+	src := settings.Source{Path: "testdata/horses-720p.mp4", Kind: SourceVideo}
+	index, err := IndexSource(src)
+	if err != nil {
+		t.Fatalf("Error indexing video: %v", err)
+	}
+	want := decodeAll(t, src.Path)
+
+	vc, err := gocv.VideoCaptureFile(src.Path)
+	if err != nil {
+		t.Fatalf("Error loading video file: %v", err)
+	}
+	defer vc.Close()
+	fc, err := NewFrameCache(vc, index, CacheOptions{MemoryBytes: 1, DiskBytes: 1 << 30}, false)
+	if err != nil {
+		t.Fatalf("Error creating frame cache: %v", err)
+	}
+	defer fc.Close()
+	size := CacheSize(1, int(vc.Get(gocv.VideoCaptureFrameWidth)), int(vc.Get(gocv.VideoCaptureFrameHeight)))
+	last := min(2*size, len(want)-1)
+	fc.SetActiveRange(0, last)
+	// Load backwards, so that nothing is prefetched and every eviction is
+	// written to disk before LoadFrame returns.
+	for n := last; n >= 0; n-- {
+		got, err := fc.LoadFrame(n)
+		if err != nil {
+			t.Fatalf("LoadFrame(%d) returned error: %v", n, err)
+		}
+		got.Close()
+	}
+	if fc.cache.Contains(last) {
+		t.Fatalf("frame %d wasn't evicted", last)
+	}
+	got, err := fc.LoadFrame(last)
+	if err != nil {
+		t.Fatalf("LoadFrame(%d) returned error: %v", last, err)
+	}
+	defer got.Close()
+	if stats := fc.Stats(); stats.DiskHits != 1 {
+		t.Errorf("reloading an evicted frame gave %d disk hits, want 1 (%v)", stats.DiskHits, stats)
+	}
+	if hashMat(got) != want[last] {
+		t.Errorf("frame %d changed after it was written to disk", last)
+	}
+}
+
+func TestSeekIndex_KeyframeBefore(t *testing.T) {
+	si := &SeekIndex{Keyframes: []int{0, 10, 20}}
+	cases := []struct {
+		n, want int
+	}{
+		{n: 0, want: 0},
+		{n: 9, want: 0},
+		{n: 10, want: 10},
+		{n: 11, want: 10},
+		{n: 25, want: 20},
+	}
+	for _, tc := range cases {
+		got := si.KeyframeBefore(tc.n)
+		if got != tc.want {
+			t.Errorf("KeyframeBefore(%d) returned incorrect value. got %d, want %d", tc.n, got, tc.want)
+		}
+	}
+}
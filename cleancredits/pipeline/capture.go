@@ -0,0 +1,53 @@
+package pipeline
+
+import (
+	"fmt"
+
+	"gocv.io/x/gocv"
+
+	"github.com/sandalwoodbox/go-cleancredits/cleancredits/settings"
+)
+
+// Source kinds
+const (
+	SourceVideo    = "video"
+	SourceSequence = "sequence"
+	SourceImage    = "image"
+)
+
+// Capture is the subset of gocv.VideoCapture used by the pipeline. It allows
+// sources other than video files (such as image sequences) to be loaded
+// frame by frame in the same way.
+type Capture interface {
+	Get(prop gocv.VideoCaptureProperties) float64
+	Set(prop gocv.VideoCaptureProperties, param float64)
+	Read(m *gocv.Mat) bool
+	Grab(skip int) error
+	CodecString() string
+	Close() error
+}
+
+// OpenCapture opens the frames described by src.
+func OpenCapture(src settings.Source) (Capture, error) {
+	switch src.Kind {
+	case SourceSequence:
+		seq, err := NewImageSequence(src.Path)
+		if err != nil {
+			return nil, err
+		}
+		return seq, nil
+	case SourceImage:
+		img, err := NewImageFile(src.Path)
+		if err != nil {
+			return nil, err
+		}
+		return img, nil
+	case SourceVideo:
+		vc, err := gocv.VideoCaptureFile(src.Path)
+		if err != nil {
+			return nil, err
+		}
+		return vc, nil
+	}
+	return nil, fmt.Errorf("unknown source kind: %q", src.Kind)
+}
@@ -0,0 +1,112 @@
+package pipeline
+
+import (
+	"image"
+	"image/color"
+
+	"gocv.io/x/gocv"
+
+	"github.com/sandalwoodbox/go-cleancredits/cleancredits/settings"
+)
+
+// hasComponentFilters returns true if s limits any property of the connected
+// components of the color selection.
+func hasComponentFilters(s settings.Mask) bool {
+	return s.MinArea > 0 || s.MaxArea > 0 ||
+		s.MinAspect > 0 || s.MaxAspect > 0 ||
+		s.MinSolidity > 0 || s.MaxSolidity > 0
+}
+
+// FilterComponents sets dst to src without the connected components that are
+// outside the area, aspect ratio and solidity limits of s.
+func FilterComponents(src gocv.Mat, dst *gocv.Mat, s settings.Mask) {
+	src.CopyTo(dst)
+	if !hasComponentFilters(s) {
+		return
+	}
+	labels := gocv.NewMat()
+	defer labels.Close()
+	stats := gocv.NewMat()
+	defer stats.Close()
+	centroids := gocv.NewMat()
+	defer centroids.Close()
+	n := gocv.ConnectedComponentsWithStats(src, &labels, &stats, &centroids)
+
+	component := gocv.NewMat()
+	defer component.Close()
+	// Label 0 is the background.
+	for i := 1; i < n; i++ {
+		stat := func(t gocv.ConnectedComponentsTypes) int {
+			return int(stats.GetIntAt(i, int(t)))
+		}
+		left, top := stat(gocv.CC_STAT_LEFT), stat(gocv.CC_STAT_TOP)
+		r := image.Rect(left, top, left+stat(gocv.CC_STAT_WIDTH), top+stat(gocv.CC_STAT_HEIGHT))
+		roi := labels.Region(r)
+		label := gocv.NewScalar(float64(i), 0, 0, 0)
+		gocv.InRangeWithScalar(roi, label, label, &component)
+		roi.Close()
+		if keepComponent(component, stat(gocv.CC_STAT_AREA), s) {
+			continue
+		}
+		gocv.BitwiseNot(component, &component)
+		roi = dst.Region(r)
+		gocv.BitwiseAnd(roi, component, &roi)
+		roi.Close()
+	}
+}
+
+// keepComponent returns true if the connected component in mask, which is
+// cropped to its bounding box and has the given area in pixels, is within
+// the limits of s.
+func keepComponent(mask gocv.Mat, area int, s settings.Mask) bool {
+	if (s.MinArea > 0 && area < s.MinArea) || (s.MaxArea > 0 && area > s.MaxArea) {
+		return false
+	}
+	aspect := float64(mask.Cols()) / float64(mask.Rows())
+	if (s.MinAspect > 0 && aspect < s.MinAspect) || (s.MaxAspect > 0 && aspect > s.MaxAspect) {
+		return false
+	}
+	if s.MinSolidity > 0 || s.MaxSolidity > 0 {
+		solidity := Solidity(mask, area) * 100
+		if (s.MinSolidity > 0 && solidity < float64(s.MinSolidity)) ||
+			(s.MaxSolidity > 0 && solidity > float64(s.MaxSolidity)) {
+			return false
+		}
+	}
+	return true
+}
+
+// Solidity returns area, the number of pixels in the shapes in mask, as a
+// fraction of the number of pixels inside their convex hull. Letters are less
+// solid than most blobs of background, and holes make shapes less solid.
+func Solidity(mask gocv.Mat, area int) float64 {
+	contours := gocv.FindContours(mask, gocv.RetrievalExternal, gocv.ChainApproxSimple)
+	defer contours.Close()
+	var points []image.Point
+	for i := range contours.Size() {
+		points = append(points, contours.At(i).ToPoints()...)
+	}
+	if len(points) == 0 {
+		return 1
+	}
+	pv := gocv.NewPointVectorFromPoints(points)
+	defer pv.Close()
+	hull := gocv.NewMat()
+	defer hull.Close()
+	gocv.ConvexHull(pv, &hull, false, true)
+	hullPoints := gocv.NewPointVectorFromMat(hull)
+	defer hullPoints.Close()
+	hullVector := gocv.NewPointsVectorFromPoints([][]image.Point{hullPoints.ToPoints()})
+	defer hullVector.Close()
+	filled := gocv.Zeros(mask.Rows(), mask.Cols(), gocv.MatTypeCV8U)
+	defer filled.Close()
+	gocv.FillPoly(&filled, hullVector, color.RGBA{255, 255, 255, 0})
+	// The filled hull can leave out edge pixels of lines and specks, which
+	// have no area.
+	gocv.BitwiseOr(filled, mask, &filled)
+	hullArea := gocv.CountNonZero(filled)
+	if hullArea == 0 {
+		return 1
+	}
+	return float64(area) / float64(hullArea)
+}
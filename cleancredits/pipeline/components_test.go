@@ -0,0 +1,152 @@
+package pipeline
+
+import (
+	"testing"
+
+	"gocv.io/x/gocv"
+
+	"github.com/sandalwoodbox/go-cleancredits/cleancredits/settings"
+)
+
+// maskFromArt returns a mask that is 255 where art has a '#'.
+func maskFromArt(art []string) [][]uint8 {
+	sl := make([][]uint8, len(art))
+	for r, row := range art {
+		sl[r] = make([]uint8, len(row))
+		for c, ch := range row {
+			if ch == '#' {
+				sl[r][c] = 255
+			}
+		}
+	}
+	return sl
+}
+
+func TestFilterComponents(t *testing.T) {
+	// A speck, a square, a U, a ring and a bar.
+	src := []string{
+		"......................",
+		".#.###.#....#.#####...",
+		"...###.#....#.#...#...",
+		"...###.#....#.#...#...",
+		".......#....#.#...#...",
+		".......######.#####...",
+		"......................",
+		".################.....",
+		"......................",
+	}
+	cases := []struct {
+		name string
+		ms   settings.Mask
+		want []string
+	}{
+		{
+			name: "no limits",
+			ms:   settings.Mask{},
+			want: src,
+		},
+		{
+			name: "min area",
+			ms:   settings.Mask{MinArea: 2},
+			want: []string{
+				"......................",
+				"...###.#....#.#####...",
+				"...###.#....#.#...#...",
+				"...###.#....#.#...#...",
+				".......#....#.#...#...",
+				".......######.#####...",
+				"......................",
+				".################.....",
+				"......................",
+			},
+		},
+		{
+			name: "max area",
+			ms:   settings.Mask{MaxArea: 15},
+			want: []string{
+				"......................",
+				".#.###.#....#.........",
+				"...###.#....#.........",
+				"...###.#....#.........",
+				".......#....#.........",
+				".......######.........",
+				"......................",
+				"......................",
+				"......................",
+			},
+		},
+		{
+			name: "aspect ratio",
+			ms:   settings.Mask{MinAspect: 0.5, MaxAspect: 2},
+			want: []string{
+				"......................",
+				".#.###.#....#.#####...",
+				"...###.#....#.#...#...",
+				"...###.#....#.#...#...",
+				".......#....#.#...#...",
+				".......######.#####...",
+				"......................",
+				"......................",
+				"......................",
+			},
+		},
+		{
+			name: "min solidity",
+			ms:   settings.Mask{MinSolidity: 50},
+			want: []string{
+				"......................",
+				".#.###........#####...",
+				"...###........#...#...",
+				"...###........#...#...",
+				"..............#...#...",
+				"..............#####...",
+				"......................",
+				".################.....",
+				"......................",
+			},
+		},
+		{
+			name: "max solidity",
+			ms:   settings.Mask{MaxSolidity: 50},
+			want: []string{
+				"......................",
+				".......#....#.........",
+				".......#....#.........",
+				".......#....#.........",
+				".......#....#.........",
+				".......######.........",
+				"......................",
+				"......................",
+				"......................",
+			},
+		},
+		{
+			// The ring's hole counts against its solidity.
+			name: "holes",
+			ms:   settings.Mask{MinSolidity: 80},
+			want: []string{
+				"......................",
+				".#.###................",
+				"...###................",
+				"...###................",
+				"......................",
+				"......................",
+				"......................",
+				".################.....",
+				"......................",
+			},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			src := sliceToGrayscaleMat(maskFromArt(src))
+			defer src.Close()
+			want := sliceToGrayscaleMat(maskFromArt(tc.want))
+			defer want.Close()
+			got := gocv.NewMat()
+			defer got.Close()
+			FilterComponents(src, &got, tc.ms)
+			compareMats(t, got, want)
+		})
+	}
+}
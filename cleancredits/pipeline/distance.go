@@ -0,0 +1,126 @@
+package pipeline
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"slices"
+
+	"gocv.io/x/gocv"
+
+	"github.com/sandalwoodbox/go-cleancredits/cleancredits/mask"
+)
+
+// toLab converts a BGR frame to CIE Lab as 32 bit floats, with L from 0 to
+// 100, so that the distance between two colors is their Delta E (CIE76).
+func toLab(mat gocv.Mat, dst *gocv.Mat) {
+	f := gocv.NewMat()
+	defer f.Close()
+	mat.ConvertTo(&f, gocv.MatTypeCV32FC3)
+	f.DivideFloat(255)
+	gocv.CvtColor(f, dst, gocv.ColorBGRToLab)
+}
+
+// colorToLab returns c in CIE Lab.
+func colorToLab(c color.RGBA) [3]float64 {
+	bgr := gocv.NewMatWithSizeFromScalar(gocv.NewScalar(float64(c.B), float64(c.G), float64(c.R), 0), 1, 1, gocv.MatTypeCV8UC3)
+	defer bgr.Close()
+	lab := gocv.NewMat()
+	defer lab.Close()
+	toLab(bgr, &lab)
+	v := lab.GetVecfAt(0, 0)
+	return [3]float64{float64(v[0]), float64(v[1]), float64(v[2])}
+}
+
+// DeltaE returns the perceptual distance (CIE76) between a and b.
+func DeltaE(a, b color.RGBA) float64 {
+	la, lb := colorToLab(a), colorToLab(b)
+	return math.Sqrt(
+		(la[0]-lb[0])*(la[0]-lb[0]) +
+			(la[1]-lb[1])*(la[1]-lb[1]) +
+			(la[2]-lb[2])*(la[2]-lb[2]),
+	)
+}
+
+// DistanceMask sets dst to 255 where mat is within deltaE of any of refs, and
+// 0 everywhere else.
+func DistanceMask(mat gocv.Mat, dst *gocv.Mat, refs []color.RGBA, deltaE int) {
+	zeros := gocv.Zeros(mat.Rows(), mat.Cols(), gocv.MatTypeCV8U)
+	defer zeros.Close()
+	zeros.CopyTo(dst)
+	if len(refs) == 0 {
+		return
+	}
+	lab := gocv.NewMat()
+	defer lab.Close()
+	toLab(mat, &lab)
+
+	ref := gocv.NewMatWithSize(mat.Rows(), mat.Cols(), gocv.MatTypeCV32FC3)
+	defer ref.Close()
+	diff := gocv.NewMat()
+	defer diff.Close()
+	sum := gocv.NewMat()
+	defer sum.Close()
+	near := gocv.NewMat()
+	defer near.Close()
+	limit := float64(deltaE * deltaE)
+	for _, c := range refs {
+		l := colorToLab(c)
+		ref.SetTo(gocv.NewScalar(l[0], l[1], l[2], 0))
+		gocv.Subtract(lab, ref, &diff)
+		gocv.Multiply(diff, diff, &diff)
+		channels := gocv.Split(diff)
+		gocv.Add(channels[0], channels[1], &sum)
+		gocv.Add(sum, channels[2], &sum)
+		for _, ch := range channels {
+			ch.Close()
+		}
+		gocv.InRangeWithScalar(sum, gocv.NewScalar(0, 0, 0, 0), gocv.NewScalar(limit, 0, 0, 0), &near)
+		gocv.BitwiseOr(*dst, near, dst)
+	}
+}
+
+// SampleMean returns the mean color of the pixels of frame within r.
+func SampleMean(frame gocv.Mat, r image.Rectangle) (color.RGBA, error) {
+	r = r.Canon().Intersect(image.Rect(0, 0, frame.Cols(), frame.Rows()))
+	if r.Empty() {
+		return color.RGBA{}, fmt.Errorf("sample is outside the frame")
+	}
+	roi := frame.Region(r)
+	defer roi.Close()
+	m := roi.Mean()
+	return color.RGBA{
+		R: uint8(math.Round(m.Val3)),
+		G: uint8(math.Round(m.Val2)),
+		B: uint8(math.Round(m.Val1)),
+		A: 255,
+	}, nil
+}
+
+// SampleFrameMean returns the mean color within r (in video pixels) of frame
+// n at full resolution.
+func (p *Pipeline) SampleFrameMean(n int, r image.Rectangle) (color.RGBA, error) {
+	frame, err := p.FrameCache.LoadFrame(n)
+	if err != nil {
+		return color.RGBA{}, fmt.Errorf("loading frame %d: %v", n, err)
+	}
+	defer frame.Close()
+	return SampleMean(frame, r)
+}
+
+// ApplyReferenceSample returns refs changed by the sampled color c. mode is
+// one of mask.SampleReplace, mask.SampleAdd or mask.SampleSubtract;
+// subtracting removes every reference color within deltaE of c.
+func ApplyReferenceSample(refs []color.RGBA, c color.RGBA, deltaE int, mode string) []color.RGBA {
+	switch mode {
+	case mask.SampleAdd:
+		return append(slices.Clone(refs), c)
+	case mask.SampleSubtract:
+		return slices.DeleteFunc(slices.Clone(refs), func(ref color.RGBA) bool {
+			return DeltaE(ref, c) <= float64(deltaE)
+		})
+	default: // mask.SampleReplace
+		return []color.RGBA{c}
+	}
+}
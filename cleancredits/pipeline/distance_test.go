@@ -0,0 +1,170 @@
+package pipeline
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"slices"
+	"testing"
+
+	"gocv.io/x/gocv"
+
+	"github.com/sandalwoodbox/go-cleancredits/cleancredits/mask"
+	"github.com/sandalwoodbox/go-cleancredits/cleancredits/settings"
+)
+
+var (
+	white     = color.RGBA{255, 255, 255, 255}
+	black     = color.RGBA{0, 0, 0, 255}
+	red       = color.RGBA{255, 0, 0, 255}
+	lightGrey = color.RGBA{220, 220, 220, 255}
+)
+
+func TestDeltaE(t *testing.T) {
+	cases := []struct {
+		name string
+		a, b color.RGBA
+		want float64
+	}{
+		{name: "same", a: red, b: red, want: 0},
+		{name: "black and white", a: black, b: white, want: 100},
+		{name: "symmetric", a: white, b: black, want: 100},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := DeltaE(tc.a, tc.b); math.Abs(got-tc.want) > 0.5 {
+				t.Errorf("DeltaE = %f, want %f", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestRenderMask_distance(t *testing.T) {
+	// White, black, red and light grey, in BGR order.
+	bgr := sliceToHSVMat([][][]uint8{
+		{
+			{255, 255, 255},
+			{0, 0, 0},
+		},
+		{
+			{0, 0, 255},
+			{220, 220, 220},
+		},
+	})
+	defer bgr.Close()
+	cases := []struct {
+		name   string
+		refs   []color.RGBA
+		deltaE int
+		want   [][]uint8
+	}{
+		{
+			name:   "no references",
+			deltaE: 50,
+			want: [][]uint8{
+				{0, 0},
+				{0, 0},
+			},
+		},
+		{
+			name:   "exact",
+			refs:   []color.RGBA{white},
+			deltaE: 0,
+			want: [][]uint8{
+				{255, 0},
+				{0, 0},
+			},
+		},
+		{
+			name:   "near white",
+			refs:   []color.RGBA{white},
+			deltaE: 15,
+			want: [][]uint8{
+				{255, 0},
+				{0, 255},
+			},
+		},
+		{
+			name:   "several references",
+			refs:   []color.RGBA{black, red},
+			deltaE: 5,
+			want: [][]uint8{
+				{0, 255},
+				{255, 0},
+			},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ms := settings.Mask{
+				Method:          mask.MethodDistance,
+				ReferenceColors: tc.refs,
+				DeltaE:          tc.deltaE,
+				CropRight:       2,
+				CropBottom:      2,
+			}
+			got := gocv.NewMat()
+			defer got.Close()
+			want := sliceToGrayscaleMat(tc.want)
+			defer want.Close()
+			RenderMask(bgr, &got, ms)
+			compareMats(t, got, want)
+		})
+	}
+}
+
+func TestSampleMean(t *testing.T) {
+	frame := gocv.NewMatWithSizeFromScalar(gocv.NewScalar(0, 0, 255, 0), 10, 10, gocv.MatTypeCV8UC3)
+	defer frame.Close()
+	// Make the right half blue.
+	right := frame.Region(image.Rect(5, 0, 10, 10))
+	right.SetTo(gocv.NewScalar(255, 0, 0, 0))
+	right.Close()
+
+	got, err := SampleMean(frame, image.Rect(0, 0, 1, 1))
+	if err != nil {
+		t.Fatalf("SampleMean returned error: %v", err)
+	}
+	if got != red {
+		t.Errorf("SampleMean of one pixel = %v, want %v", got, red)
+	}
+	got, err = SampleMean(frame, image.Rect(0, 0, 10, 10))
+	if err != nil {
+		t.Fatalf("SampleMean returned error: %v", err)
+	}
+	if want := (color.RGBA{128, 0, 128, 255}); got != want {
+		t.Errorf("SampleMean of both halves = %v, want %v", got, want)
+	}
+	_, err = SampleMean(frame, image.Rect(20, 20, 30, 30))
+	if err == nil {
+		t.Error("SampleMean outside the frame didn't return an error")
+	}
+}
+
+func TestApplyReferenceSample(t *testing.T) {
+	cases := []struct {
+		name   string
+		refs   []color.RGBA
+		c      color.RGBA
+		deltaE int
+		mode   string
+		want   []color.RGBA
+	}{
+		{name: "replace", refs: []color.RGBA{black, red}, c: white, mode: mask.SampleReplace, want: []color.RGBA{white}},
+		{name: "add", refs: []color.RGBA{black}, c: white, mode: mask.SampleAdd, want: []color.RGBA{black, white}},
+		{name: "subtract nearby", refs: []color.RGBA{white, black, lightGrey}, c: white, deltaE: 15, mode: mask.SampleSubtract, want: []color.RGBA{black}},
+		{name: "subtract nothing", refs: []color.RGBA{black}, c: white, deltaE: 15, mode: mask.SampleSubtract, want: []color.RGBA{black}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			refs := slices.Clone(tc.refs)
+			got := ApplyReferenceSample(refs, tc.c, tc.deltaE, tc.mode)
+			if !slices.Equal(got, tc.want) {
+				t.Errorf("ApplyReferenceSample = %v, want %v", got, tc.want)
+			}
+			if !slices.Equal(refs, tc.refs) {
+				t.Errorf("ApplyReferenceSample changed refs to %v", refs)
+			}
+		})
+	}
+}
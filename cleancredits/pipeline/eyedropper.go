@@ -0,0 +1,282 @@
+package pipeline
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"slices"
+
+	"gocv.io/x/gocv"
+
+	"github.com/sandalwoodbox/go-cleancredits/cleancredits/mask"
+	"github.com/sandalwoodbox/go-cleancredits/cleancredits/settings"
+	"github.com/sandalwoodbox/go-cleancredits/cleancredits/utils"
+)
+
+// SampleTrim is the fraction of sampled pixels ignored at each end of every
+// channel, so that a few stray background pixels in a sampled box don't
+// widen the range.
+const SampleTrim = 0.05
+
+// ColorSample is the range of each channel of some sampled pixels, in the
+// mask's color space.
+type ColorSample struct {
+	Min [3]int
+	Max [3]int
+}
+
+// SampleColor returns the range of values of the pixels of frame within r,
+// converted to colorSpace. Hues are circular, so the hue range is the
+// shortest one that covers the sample, and its Min is greater than its Max
+// if it wraps around past the maximum hue back to 0.
+func SampleColor(frame gocv.Mat, r image.Rectangle, colorSpace string) (ColorSample, error) {
+	r = r.Canon().Intersect(image.Rect(0, 0, frame.Cols(), frame.Rows()))
+	if r.Empty() {
+		return ColorSample{}, fmt.Errorf("sample is outside the frame")
+	}
+	roi := frame.Region(r)
+	defer roi.Close()
+	converted := gocv.NewMat()
+	defer converted.Close()
+	ConvertColor(roi, &converted, colorSpace)
+
+	var hists [3][256]int
+	data := converted.ToBytes()
+	for i, b := range data {
+		hists[i%3][b]++
+	}
+	n := len(data) / 3
+	skip := int(float64(n) * SampleTrim)
+	channels := mask.ColorSpaceChannels(colorSpace)
+	var s ColorSample
+	for c, hist := range hists {
+		if channels.Hue && c == 0 {
+			s.Min[c], s.Max[c] = trimmedArc(hist, channels.Max[c]+1, n-skip, skip)
+		} else {
+			s.Min[c], s.Max[c] = trimmedRange(hist, n-skip, skip)
+		}
+	}
+	return s, nil
+}
+
+// trimmedArc is trimmedRange for a circular channel with period values. It
+// tries starting the channel at each value, and returns the shortest range.
+func trimmedArc(hist [256]int, period, keep, skip int) (lo, hi int) {
+	best := period
+	for start := range period {
+		var rotated [256]int
+		for v := range period {
+			rotated[v] = hist[(v+start)%period]
+		}
+		l, h := trimmedRange(rotated, keep, skip)
+		if h-l < best {
+			best = h - l
+			lo, hi = (l+start)%period, (h+start)%period
+		}
+	}
+	return lo, hi
+}
+
+// trimmedRange returns the lowest and highest values in hist after skip
+// values have been ignored at each end. keep is the total count less skip.
+func trimmedRange(hist [256]int, keep, skip int) (lo, hi int) {
+	lo, hi = -1, -1
+	count := 0
+	for v, c := range hist {
+		count += c
+		if lo < 0 && count > skip {
+			lo = v
+		}
+		if hi < 0 && count >= keep {
+			hi = v
+		}
+	}
+	return lo, hi
+}
+
+// SampleFrame returns the range of values within r (in video pixels) of
+// frame n at full resolution, converted to colorSpace.
+func (p *Pipeline) SampleFrame(n int, r image.Rectangle, colorSpace string) (ColorSample, error) {
+	frame, err := p.FrameCache.LoadFrame(n)
+	if err != nil {
+		return ColorSample{}, fmt.Errorf("loading frame %d: %v", n, err)
+	}
+	defer frame.Close()
+	return SampleColor(frame, r, colorSpace)
+}
+
+// ApplySample returns ms with its color ranges changed by s. The sample is
+// widened by tolerance in each channel first. mode is one of
+// mask.SampleReplace, mask.SampleAdd or mask.SampleSubtract. Hue ranges wrap
+// around, so adding red to red can give a range from 170 to 10.
+func ApplySample(ms settings.Mask, s ColorSample, tolerance int, mode string) settings.Mask {
+	channels := mask.ColorSpaceChannels(ms.ColorSpace)
+	ranges := [3][2]*int{
+		{&ms.Min[0], &ms.Max[0]},
+		{&ms.Min[1], &ms.Max[1]},
+		{&ms.Min[2], &ms.Max[2]},
+	}
+	var lo, hi [3]int
+	var wrap [3]bool
+	for c := range ranges {
+		wrap[c] = channels.Hue && c == 0
+		lo[c], hi[c] = widen(s.Min[c], s.Max[c], tolerance, channels.Max[c], wrap[c])
+	}
+
+	switch mode {
+	case mask.SampleAdd:
+		for c, r := range ranges {
+			union := valueSet(*r[0], *r[1], channels.Max[c], wrap[c])
+			for v, in := range valueSet(lo[c], hi[c], channels.Max[c], wrap[c]) {
+				union[v] = union[v] || in
+			}
+			*r[0], *r[1] = cover(union, wrap[c])
+		}
+	case mask.SampleSubtract:
+		// Pixels are only selected if every channel is in range, so the
+		// sample can be excluded by cutting one channel. Cut whichever one
+		// keeps the largest part of its current range.
+		best := 0.0
+		var cut func()
+		for c, r := range ranges {
+			current := valueSet(*r[0], *r[1], channels.Max[c], wrap[c])
+			sample := valueSet(lo[c], hi[c], channels.Max[c], wrap[c])
+			overlaps := false
+			size := 0
+			for v, in := range current {
+				if in {
+					size++
+					overlaps = overlaps || sample[v]
+					current[v] = !sample[v]
+				}
+			}
+			if !overlaps {
+				// The sample is already excluded.
+				return ms
+			}
+			keepLo, keepHi, kept := longestRun(current, wrap[c])
+			if fraction := float64(kept) / float64(size); fraction > best {
+				best = fraction
+				cut = func() { *r[0], *r[1] = keepLo, keepHi }
+			}
+		}
+		if cut != nil {
+			cut()
+		}
+	default: // mask.SampleReplace
+		for c, r := range ranges {
+			*r[0] = lo[c]
+			*r[1] = hi[c]
+		}
+	}
+	return ms
+}
+
+// widen returns the range lo to hi widened by tolerance at each end, within
+// 0 to max. If wrap is set, the range is circular and wraps around instead,
+// unless that would cover every value.
+func widen(lo, hi, tolerance, max int, wrap bool) (int, int) {
+	if !wrap {
+		return utils.ClampInt(lo-tolerance, 0, max), utils.ClampInt(hi+tolerance, 0, max)
+	}
+	period := max + 1
+	if mod(hi-lo, period)+1+2*tolerance >= period {
+		return 0, max
+	}
+	return mod(lo-tolerance, period), mod(hi+tolerance, period)
+}
+
+func mod(a, n int) int {
+	return (a%n + n) % n
+}
+
+// valueSet returns which of the values from 0 to max are in the range lo to
+// hi. If wrap is set and lo is greater than hi, the range wraps around past
+// max back to 0; otherwise it is empty.
+func valueSet(lo, hi, max int, wrap bool) []bool {
+	set := make([]bool, max+1)
+	lo = utils.ClampInt(lo, 0, max)
+	hi = utils.ClampInt(hi, 0, max)
+	switch {
+	case lo <= hi:
+		for v := lo; v <= hi; v++ {
+			set[v] = true
+		}
+	case wrap:
+		for v := lo; v <= max; v++ {
+			set[v] = true
+		}
+		for v := 0; v <= hi; v++ {
+			set[v] = true
+		}
+	}
+	return set
+}
+
+// longestRun returns the longest run of values in set, and its length. If
+// wrap is set, runs can wrap around from the last value to the first.
+func longestRun(set []bool, wrap bool) (lo, hi, length int) {
+	n := len(set)
+	start := 0
+	if wrap {
+		// Start just after a value that isn't in the set, so that no run
+		// is split in two.
+		start = slices.Index(set, false)
+		if start < 0 {
+			return 0, n - 1, n
+		}
+	}
+	run := 0
+	for i := range n {
+		v := (start + i) % n
+		if !set[v] {
+			run = 0
+			continue
+		}
+		run++
+		if run > length {
+			length = run
+			hi = v
+		}
+	}
+	return mod(hi-length+1, n), hi, length
+}
+
+// cover returns the shortest range that includes every value in set. If wrap
+// is set, the range may wrap around, skipping the longest gap in set.
+func cover(set []bool, wrap bool) (lo, hi int) {
+	n := len(set)
+	if !wrap {
+		lo, hi = -1, -1
+		for v, in := range set {
+			if !in {
+				continue
+			}
+			if lo < 0 {
+				lo = v
+			}
+			hi = v
+		}
+		return lo, hi
+	}
+	gap := make([]bool, n)
+	for v, in := range set {
+		gap[v] = !in
+	}
+	gapLo, gapHi, gapLength := longestRun(gap, true)
+	if gapLength == 0 {
+		return 0, n - 1
+	}
+	return mod(gapHi+1, n), mod(gapLo-1, n)
+}
+
+// SampleRect returns the rectangle of video pixels between two video points,
+// including both of them.
+func SampleRect(x0, y0, x1, y1 float64) image.Rectangle {
+	r := image.Rect(
+		int(math.Floor(x0)), int(math.Floor(y0)),
+		int(math.Floor(x1)), int(math.Floor(y1)),
+	)
+	r.Max = r.Max.Add(image.Pt(1, 1))
+	return r
+}
@@ -0,0 +1,227 @@
+package pipeline
+
+import (
+	"image"
+	"testing"
+
+	"gocv.io/x/gocv"
+
+	"github.com/sandalwoodbox/go-cleancredits/cleancredits/mask"
+	"github.com/sandalwoodbox/go-cleancredits/cleancredits/settings"
+)
+
+func TestSampleColor(t *testing.T) {
+	// Blue, with a single red pixel, reds either side of hue 0 and a row of
+	// greys from 0 to 99.
+	frame := gocv.NewMatWithSizeFromScalar(gocv.NewScalar(255, 0, 0, 0), 20, 100, gocv.MatTypeCV8UC3)
+	defer frame.Close()
+	frame.SetUCharAt3(5, 5, 0, 0)
+	frame.SetUCharAt3(5, 5, 1, 0)
+	frame.SetUCharAt3(5, 5, 2, 255)
+	for x, bgr := range [][3]uint8{{0, 0, 255}, {43, 0, 255}, {0, 43, 255}} {
+		for c := range 3 {
+			frame.SetUCharAt3(15, x, c, bgr[c])
+		}
+	}
+	for x := range 100 {
+		for c := range 3 {
+			frame.SetUCharAt3(19, x, c, uint8(x))
+		}
+	}
+
+	cases := []struct {
+		name string
+		r    image.Rectangle
+		want ColorSample
+	}{
+		{
+			name: "single pixel",
+			r:    image.Rect(0, 0, 1, 1),
+			want: ColorSample{Min: [3]int{120, 255, 255}, Max: [3]int{120, 255, 255}},
+		},
+		{
+			name: "red pixel",
+			r:    image.Rect(5, 5, 6, 6),
+			want: ColorSample{Min: [3]int{0, 255, 255}, Max: [3]int{0, 255, 255}},
+		},
+		{
+			name: "stray pixel is trimmed",
+			r:    image.Rect(0, 0, 10, 10),
+			want: ColorSample{Min: [3]int{120, 255, 255}, Max: [3]int{120, 255, 255}},
+		},
+		{
+			name: "greys",
+			r:    image.Rect(0, 19, 100, 20),
+			want: ColorSample{Min: [3]int{0, 0, 5}, Max: [3]int{0, 0, 94}},
+		},
+		{
+			name: "reds wrap around",
+			r:    image.Rect(0, 15, 3, 16),
+			want: ColorSample{Min: [3]int{175, 255, 255}, Max: [3]int{5, 255, 255}},
+		},
+		{
+			name: "partly outside the frame",
+			r:    image.Rect(-10, -10, 1, 1),
+			want: ColorSample{Min: [3]int{120, 255, 255}, Max: [3]int{120, 255, 255}},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := SampleColor(frame, tc.r, mask.ColorSpaceHSV)
+			if err != nil {
+				t.Fatalf("SampleColor returned error: %v", err)
+			}
+			if got != tc.want {
+				t.Errorf("SampleColor = %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+
+	_, err := SampleColor(frame, image.Rect(200, 200, 210, 210), mask.ColorSpaceHSV)
+	if err == nil {
+		t.Error("SampleColor outside the frame didn't return an error")
+	}
+}
+
+func TestApplySample(t *testing.T) {
+	full := settings.Mask{Max: [3]int{179, 255, 255}}
+	narrow := settings.Mask{Min: [3]int{100, 100, 150}, Max: [3]int{140, 200, 250}}
+	red := settings.Mask{Min: [3]int{170, 100, 150}, Max: [3]int{10, 200, 250}}
+	cases := []struct {
+		name      string
+		ms        settings.Mask
+		sample    ColorSample
+		tolerance int
+		mode      string
+		want      settings.Mask
+	}{
+		{
+			name:      "replace",
+			ms:        full,
+			sample:    ColorSample{Min: [3]int{110, 120, 200}, Max: [3]int{115, 130, 210}},
+			tolerance: 5,
+			mode:      mask.SampleReplace,
+			want:      settings.Mask{Min: [3]int{105, 115, 195}, Max: [3]int{120, 135, 215}},
+		},
+		{
+			name:      "replace is clamped",
+			ms:        full,
+			sample:    ColorSample{Min: [3]int{2, 0, 250}, Max: [3]int{178, 3, 255}},
+			tolerance: 10,
+			mode:      mask.SampleReplace,
+			want:      settings.Mask{Min: [3]int{0, 0, 240}, Max: [3]int{179, 13, 255}},
+		},
+		{
+			name:      "add",
+			ms:        narrow,
+			sample:    ColorSample{Min: [3]int{90, 150, 240}, Max: [3]int{120, 160, 255}},
+			tolerance: 0,
+			mode:      mask.SampleAdd,
+			want:      settings.Mask{Min: [3]int{90, 100, 150}, Max: [3]int{140, 200, 255}},
+		},
+		{
+			name:      "subtract cuts the channel that keeps the most",
+			ms:        narrow,
+			sample:    ColorSample{Min: [3]int{100, 100, 240}, Max: [3]int{140, 200, 250}},
+			tolerance: 0,
+			mode:      mask.SampleSubtract,
+			want:      settings.Mask{Min: [3]int{100, 100, 150}, Max: [3]int{140, 200, 239}},
+		},
+		{
+			name:      "subtract from below",
+			ms:        narrow,
+			sample:    ColorSample{Min: [3]int{90, 100, 150}, Max: [3]int{105, 200, 250}},
+			tolerance: 0,
+			mode:      mask.SampleSubtract,
+			want:      settings.Mask{Min: [3]int{106, 100, 150}, Max: [3]int{140, 200, 250}},
+		},
+		{
+			name:      "subtract an excluded sample",
+			ms:        narrow,
+			sample:    ColorSample{Min: [3]int{0, 100, 150}, Max: [3]int{50, 200, 250}},
+			tolerance: 0,
+			mode:      mask.SampleSubtract,
+			want:      narrow,
+		},
+		{
+			name:      "subtract everything",
+			ms:        narrow,
+			sample:    ColorSample{Min: [3]int{100, 100, 150}, Max: [3]int{140, 200, 250}},
+			tolerance: 0,
+			mode:      mask.SampleSubtract,
+			want:      narrow,
+		},
+		{
+			name:      "replace with a wrapped sample",
+			ms:        full,
+			sample:    ColorSample{Min: [3]int{175, 100, 150}, Max: [3]int{5, 200, 250}},
+			tolerance: 0,
+			mode:      mask.SampleReplace,
+			want:      settings.Mask{Min: [3]int{175, 100, 150}, Max: [3]int{5, 200, 250}},
+		},
+		{
+			name:      "replace wraps the tolerance",
+			ms:        full,
+			sample:    ColorSample{Min: [3]int{2, 100, 150}, Max: [3]int{5, 200, 250}},
+			tolerance: 5,
+			mode:      mask.SampleReplace,
+			want:      settings.Mask{Min: [3]int{177, 95, 145}, Max: [3]int{10, 205, 255}},
+		},
+		{
+			name:      "add inside a wrapped range",
+			ms:        red,
+			sample:    ColorSample{Min: [3]int{5, 100, 150}, Max: [3]int{8, 200, 250}},
+			tolerance: 0,
+			mode:      mask.SampleAdd,
+			want:      red,
+		},
+		{
+			name:      "add across 0",
+			ms:        settings.Mask{Min: [3]int{170, 100, 150}, Max: [3]int{175, 200, 250}},
+			sample:    ColorSample{Min: [3]int{178, 100, 150}, Max: [3]int{3, 200, 250}},
+			tolerance: 0,
+			mode:      mask.SampleAdd,
+			want:      settings.Mask{Min: [3]int{170, 100, 150}, Max: [3]int{3, 200, 250}},
+		},
+		{
+			name:      "add the shorter way around",
+			ms:        red,
+			sample:    ColorSample{Min: [3]int{20, 100, 150}, Max: [3]int{25, 200, 250}},
+			tolerance: 0,
+			mode:      mask.SampleAdd,
+			want:      settings.Mask{Min: [3]int{170, 100, 150}, Max: [3]int{25, 200, 250}},
+		},
+		{
+			name:      "subtract from a wrapped range",
+			ms:        red,
+			sample:    ColorSample{Min: [3]int{175, 100, 150}, Max: [3]int{10, 200, 250}},
+			tolerance: 0,
+			mode:      mask.SampleSubtract,
+			want:      settings.Mask{Min: [3]int{170, 100, 150}, Max: [3]int{174, 200, 250}},
+		},
+		{
+			name:      "subtract across 0 keeps the longer side",
+			ms:        settings.Mask{Min: [3]int{160, 100, 150}, Max: [3]int{20, 200, 250}},
+			sample:    ColorSample{Min: [3]int{176, 100, 150}, Max: [3]int{2, 200, 250}},
+			tolerance: 0,
+			mode:      mask.SampleSubtract,
+			want:      settings.Mask{Min: [3]int{3, 100, 150}, Max: [3]int{20, 200, 250}},
+		},
+		{
+			name:      "subtract a wrapped sample that is excluded",
+			ms:        narrow,
+			sample:    ColorSample{Min: [3]int{170, 100, 150}, Max: [3]int{10, 200, 250}},
+			tolerance: 0,
+			mode:      mask.SampleSubtract,
+			want:      narrow,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := ApplySample(tc.ms, tc.sample, tc.tolerance, tc.mode)
+			if got.Min != tc.want.Min || got.Max != tc.want.Max {
+				t.Errorf("ApplySample = %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
@@ -1,8 +1,10 @@
 package pipeline
 
 import (
+	"context"
 	"fmt"
 	"image"
+	"image/color"
 	"math"
 
 	"gocv.io/x/gocv"
@@ -17,51 +19,185 @@ func EmptyImage() image.Image {
 }
 
 func RenderMask(mat gocv.Mat, dst *gocv.Mat, s settings.Mask) {
+	stages := RenderMaskStages(mat, s)
+	defer stages.Close()
+	gocv.BitwiseAnd(stages.Morphed, stages.Crop, dst)
+}
+
+// MaskStages are the intermediate masks that RenderMask combines. Each is 255
+// where its step selects the pixel.
+type MaskStages struct {
+	// Color selects pixels by their color.
+	Color gocv.Mat
+	// Filtered is Color after FilterComponents.
+	Filtered gocv.Mat
+	// Morphed is Filtered after Morph.
+	Morphed gocv.Mat
+	// Crop is the crop region.
+	Crop gocv.Mat
+}
+
+func (m MaskStages) Close() {
+	m.Color.Close()
+	m.Filtered.Close()
+	m.Morphed.Close()
+	m.Crop.Close()
+}
+
+// RenderMaskStages returns the steps of rendering the mask for s from mat.
+// The caller must close the result.
+func RenderMaskStages(mat gocv.Mat, s settings.Mask) MaskStages {
+	m, _ := renderMaskStages(context.Background(), mat, s)
+	return m
+}
+
+// renderMaskStages is RenderMaskStages, but it stops between steps if ctx is
+// cancelled and returns ctx.Err(), with nothing left to close.
+func renderMaskStages(ctx context.Context, mat gocv.Mat, s settings.Mask) (MaskStages, error) {
+	m := MaskStages{Color: gocv.NewMat(), Filtered: gocv.NewMat(), Morphed: gocv.NewMat(), Crop: gocv.NewMat()}
+	cancelled := func() bool {
+		if ctx.Err() == nil {
+			return false
+		}
+		m.Close()
+		return true
+	}
+	if s.Method == mask.MethodDistance {
+		DistanceMask(mat, &m.Color, s.ReferenceColors, s.DeltaE)
+	} else {
+		renderRangeMask(mat, &m.Color, s)
+	}
+	if cancelled() {
+		return MaskStages{}, ctx.Err()
+	}
+	FilterComponents(m.Color, &m.Filtered, s)
+	if cancelled() {
+		return MaskStages{}, ctx.Err()
+	}
+	Morph(m.Filtered, &m.Morphed, s)
+	if cancelled() {
+		return MaskStages{}, ctx.Err()
+	}
+
+	m.Crop.Close()
+	m.Crop = maskCrop(m.Color.Rows(), m.Color.Cols(), s)
+	return m, nil
+}
+
+// maskCrop returns the crop mask for s: the union of s.Crops, or the
+// CropLeft, CropTop, CropRight and CropBottom rectangle if there aren't any.
+func maskCrop(rows, cols int, s settings.Mask) gocv.Mat {
+	if len(s.Crops) > 0 {
+		return CropsMask(rows, cols, s.Crops)
+	}
 	if s.CropTop > s.CropBottom {
 		s.CropTop, s.CropBottom = s.CropBottom, s.CropTop
 	}
 	if s.CropLeft > s.CropRight {
 		s.CropLeft, s.CropRight = s.CropRight, s.CropLeft
 	}
-	s.CropBottom = utils.ClampInt(s.CropBottom, 0, mat.Rows())
-	s.CropTop = utils.ClampInt(s.CropTop, 0, mat.Rows())
-	s.CropLeft = utils.ClampInt(s.CropLeft, 0, mat.Cols())
-	s.CropRight = utils.ClampInt(s.CropRight, 0, mat.Cols())
+	s.CropBottom = utils.ClampInt(s.CropBottom, 0, rows)
+	s.CropTop = utils.ClampInt(s.CropTop, 0, rows)
+	s.CropLeft = utils.ClampInt(s.CropLeft, 0, cols)
+	s.CropRight = utils.ClampInt(s.CropRight, 0, cols)
+	return CropMask(rows, cols, image.Rect(s.CropLeft, s.CropTop, s.CropRight, s.CropBottom))
+}
+
+// renderRangeMask sets dst to 255 where mat is within the color ranges of s.
+func renderRangeMask(mat gocv.Mat, dst *gocv.Mat, s settings.Mask) {
+	frameColor := gocv.NewMat()
+	defer frameColor.Close()
+	ConvertColor(mat, &frameColor, s.ColorSpace)
+
+	channels := mask.ColorSpaceChannels(s.ColorSpace)
+	if channels.Hue && s.Min[0] > s.Max[0] {
+		// The hue range wraps around past the maximum hue back to 0, which
+		// takes two passes.
+		inRange(frameColor, dst, s.Min[0], channels.Max[0], s)
+		low := gocv.NewMat()
+		defer low.Close()
+		inRange(frameColor, &low, 0, s.Max[0], s)
+		gocv.BitwiseOr(*dst, low, dst)
+	} else {
+		inRange(frameColor, dst, s.Min[0], s.Max[0], s)
+	}
+}
+
+// colorConversions converts BGR frames to each color space.
+var colorConversions = map[string]gocv.ColorConversionCode{
+	mask.ColorSpaceHSV:   gocv.ColorBGRToHSV,
+	mask.ColorSpaceHLS:   gocv.ColorBGRToHLS,
+	mask.ColorSpaceLab:   gocv.ColorBGRToLab,
+	mask.ColorSpaceYCrCb: gocv.ColorBGRToYCrCb,
+	mask.ColorSpaceRGB:   gocv.ColorBGRToRGB,
+}
 
-	frameHSV := gocv.NewMat()
-	defer frameHSV.Close()
-	gocv.CvtColor(mat, &frameHSV, gocv.ColorBGRToHSV)
+// ConvertColor converts the BGR frame mat to the given color space. Unknown
+// color spaces are treated as HSV.
+func ConvertColor(mat gocv.Mat, dst *gocv.Mat, colorSpace string) {
+	code, ok := colorConversions[colorSpace]
+	if !ok {
+		code = gocv.ColorBGRToHSV
+	}
+	gocv.CvtColor(mat, dst, code)
+}
 
-	hsvMask := gocv.NewMat()
-	defer hsvMask.Close()
+// inRange sets dst to 255 where the first channel of frame is between
+// firstMin and firstMax and the other channels are within the ranges of s.
+func inRange(frame gocv.Mat, dst *gocv.Mat, firstMin, firstMax int, s settings.Mask) {
 	gocv.InRangeWithScalar(
-		frameHSV,
-		gocv.NewScalar(float64(s.HueMin), float64(s.SatMin), float64(s.ValMin), 0),
-		gocv.NewScalar(float64(s.HueMax), float64(s.SatMax), float64(s.ValMax), 0),
-		&hsvMask,
+		frame,
+		gocv.NewScalar(float64(firstMin), float64(s.Min[1]), float64(s.Min[2]), 0),
+		gocv.NewScalar(float64(firstMax), float64(s.Max[1]), float64(s.Max[2]), 0),
+		dst,
 	)
+}
 
-	var grown gocv.Mat
-	if s.Grow > 0 {
-		grown = gocv.NewMat()
-		kernel := gocv.Ones(s.Grow, s.Grow, gocv.MatTypeCV8U)
-		defer kernel.Close()
-		gocv.Dilate(hsvMask, &grown, kernel)
-	} else {
-		grown = hsvMask.Clone()
+// CropMask returns a single channel mask of the given size that is 255 inside
+// r and 0 everywhere else. r must already be within the mask.
+func CropMask(rows, cols int, r image.Rectangle) gocv.Mat {
+	m := gocv.Zeros(rows, cols, gocv.MatTypeCV8U)
+	if r.Empty() {
+		return m
 	}
-	defer grown.Close()
+	roi := m.Region(r)
+	defer roi.Close()
+	roi.SetTo(gocv.NewScalar(255, 0, 0, 0))
+	return m
+}
 
-	// TODO: This is the slowest part of UpdateMask. Can it be faster / cached?
-	bboxMask := gocv.Zeros(hsvMask.Rows(), hsvMask.Cols(), gocv.MatTypeCV8U)
-	defer bboxMask.Close()
-	for x := s.CropLeft; x < s.CropRight; x++ {
-		for y := s.CropTop; y < s.CropBottom; y++ {
-			bboxMask.SetUCharAt(y, x, 255)
+// CropsMask returns a single channel mask of the given size that is 255
+// inside any of crops and 0 everywhere else.
+func CropsMask(rows, cols int, crops []settings.Crop) gocv.Mat {
+	m := gocv.Zeros(rows, cols, gocv.MatTypeCV8U)
+	white := color.RGBA{R: 255}
+	for _, c := range crops {
+		r := image.Rect(c.Left, c.Top, c.Right, c.Bottom)
+		switch c.Shape {
+		case mask.CropEllipse:
+			if r.Empty() {
+				continue
+			}
+			center := image.Pt((r.Min.X+r.Max.X)/2, (r.Min.Y+r.Max.Y)/2)
+			gocv.Ellipse(&m, center, image.Pt(r.Dx()/2, r.Dy()/2), 0, 0, 360, white, -1)
+		case mask.CropPolygon:
+			if len(c.Points) < 3 {
+				continue
+			}
+			pv := gocv.NewPointsVectorFromPoints([][]image.Point{c.Points})
+			gocv.FillPoly(&m, pv, white)
+			pv.Close()
+		default: // mask.CropRectangle
+			r = r.Intersect(image.Rect(0, 0, cols, rows))
+			if r.Empty() {
+				continue
+			}
+			roi := m.Region(r)
+			roi.SetTo(gocv.NewScalar(255, 0, 0, 0))
+			roi.Close()
 		}
 	}
-	gocv.BitwiseAnd(grown, bboxMask, dst)
-	gocv.BitwiseAndWithMask(grown, grown, dst, bboxMask)
+	return m
 }
 
 func CombineMasks(mode string, top gocv.Mat, bottom, dst *gocv.Mat) {
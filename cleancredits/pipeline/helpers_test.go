@@ -330,12 +330,8 @@ func TestRenderMask_horses(t *testing.T) {
 	for _, tc := range cases {
 		t.Run(tc.name, func(t *testing.T) {
 			ms := settings.Mask{
-				HueMin:     tc.hueMin,
-				HueMax:     tc.hueMax,
-				SatMin:     tc.satMin,
-				SatMax:     tc.satMax,
-				ValMin:     tc.valMin,
-				ValMax:     tc.valMax,
+				Min:        [3]int{tc.hueMin, tc.satMin, tc.valMin},
+				Max:        [3]int{tc.hueMax, tc.satMax, tc.valMax},
 				Grow:       tc.grow,
 				CropLeft:   tc.cropLeft,
 				CropRight:  tc.cropRight,
@@ -660,17 +656,84 @@ func TestRenderMask_manual(t *testing.T) {
 				{0, 0, 0, 0, 0},
 			},
 		},
+		{
+			name: "hue wraps around",
+			hsv: [][][]uint8{
+				{
+					{0, 255, 255},
+					{5, 255, 255},
+				},
+				{
+					{90, 255, 255},
+					{175, 255, 255},
+				},
+			},
+			hueMin:     170,
+			hueMax:     10,
+			satMax:     255,
+			valMax:     255,
+			cropRight:  2,
+			cropBottom: 2,
+			want: [][]uint8{
+				{255, 255},
+				{0, 255},
+			},
+		},
+		{
+			name: "hue wraps around excluding both ends",
+			hsv: [][][]uint8{
+				{
+					{0, 255, 255},
+					{20, 255, 255},
+				},
+				{
+					{150, 255, 255},
+					{175, 255, 255},
+				},
+			},
+			hueMin:     170,
+			hueMax:     10,
+			satMax:     255,
+			valMax:     255,
+			cropRight:  2,
+			cropBottom: 2,
+			want: [][]uint8{
+				{255, 0},
+				{0, 255},
+			},
+		},
+		{
+			name: "hue wraps around with sat and val",
+			hsv: [][][]uint8{
+				{
+					{0, 255, 255},
+					{0, 100, 255},
+				},
+				{
+					{175, 255, 100},
+					{175, 255, 255},
+				},
+			},
+			hueMin:     170,
+			hueMax:     10,
+			satMin:     200,
+			satMax:     255,
+			valMin:     200,
+			valMax:     255,
+			cropRight:  2,
+			cropBottom: 2,
+			want: [][]uint8{
+				{255, 0},
+				{0, 255},
+			},
+		},
 	}
 
 	for _, tc := range cases {
 		t.Run(tc.name, func(t *testing.T) {
 			ms := settings.Mask{
-				HueMin:     tc.hueMin,
-				HueMax:     tc.hueMax,
-				SatMin:     tc.satMin,
-				SatMax:     tc.satMax,
-				ValMin:     tc.valMin,
-				ValMax:     tc.valMax,
+				Min:        [3]int{tc.hueMin, tc.satMin, tc.valMin},
+				Max:        [3]int{tc.hueMax, tc.satMax, tc.valMax},
 				Grow:       tc.grow,
 				CropLeft:   tc.cropLeft,
 				CropRight:  tc.cropRight,
@@ -691,6 +754,95 @@ func TestRenderMask_manual(t *testing.T) {
 	}
 }
 
+func TestRenderMask_colorSpaces(t *testing.T) {
+	// White, black, red and grey, in BGR order.
+	bgr := sliceToHSVMat([][][]uint8{
+		{
+			{255, 255, 255},
+			{0, 0, 0},
+		},
+		{
+			{0, 0, 255},
+			{128, 128, 128},
+		},
+	})
+	defer bgr.Close()
+	cases := []struct {
+		name       string
+		colorSpace string
+		min, max   [3]int
+		want       [][]uint8
+	}{
+		{
+			name:       "rgb red",
+			colorSpace: mask.ColorSpaceRGB,
+			min:        [3]int{200, 0, 0},
+			max:        [3]int{255, 50, 50},
+			want: [][]uint8{
+				{0, 0},
+				{255, 0},
+			},
+		},
+		{
+			name:       "lab lightness",
+			colorSpace: mask.ColorSpaceLab,
+			min:        [3]int{200, 0, 0},
+			max:        [3]int{255, 255, 255},
+			want: [][]uint8{
+				{255, 0},
+				{0, 0},
+			},
+		},
+		{
+			name:       "ycrcb luma",
+			colorSpace: mask.ColorSpaceYCrCb,
+			min:        [3]int{0, 0, 0},
+			max:        [3]int{150, 255, 255},
+			want: [][]uint8{
+				{0, 255},
+				{255, 255},
+			},
+		},
+		{
+			name:       "hls lightness",
+			colorSpace: mask.ColorSpaceHLS,
+			min:        [3]int{0, 0, 0},
+			max:        [3]int{179, 10, 255},
+			want: [][]uint8{
+				{0, 255},
+				{0, 0},
+			},
+		},
+		{
+			name:       "no wraparound outside hue color spaces",
+			colorSpace: mask.ColorSpaceLab,
+			min:        [3]int{200, 0, 0},
+			max:        [3]int{100, 255, 255},
+			want: [][]uint8{
+				{0, 0},
+				{0, 0},
+			},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ms := settings.Mask{
+				ColorSpace: tc.colorSpace,
+				Min:        tc.min,
+				Max:        tc.max,
+				CropRight:  2,
+				CropBottom: 2,
+			}
+			got := gocv.NewMat()
+			defer got.Close()
+			want := sliceToGrayscaleMat(tc.want)
+			defer want.Close()
+			RenderMask(bgr, &got, ms)
+			compareMats(t, got, want)
+		})
+	}
+}
+
 func TestCombineMasks(t *testing.T) {
 	cases := []struct {
 		name   string
@@ -1434,3 +1586,162 @@ func TestZoomCropRectangle(t *testing.T) {
 		})
 	}
 }
+
+// cropMaskLoop is the original per-pixel implementation of CropMask, kept as
+// a reference for TestCropMask and BenchmarkCropMask.
+func cropMaskLoop(rows, cols int, r image.Rectangle) gocv.Mat {
+	m := gocv.Zeros(rows, cols, gocv.MatTypeCV8U)
+	for x := r.Min.X; x < r.Max.X; x++ {
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			m.SetUCharAt(y, x, 255)
+		}
+	}
+	return m
+}
+
+func TestCropMask(t *testing.T) {
+	cases := []struct {
+		name string
+		r    image.Rectangle
+	}{
+		{name: "full frame", r: image.Rect(0, 0, 64, 48)},
+		{name: "inside", r: image.Rect(10, 5, 30, 40)},
+		{name: "edge", r: image.Rect(60, 0, 64, 48)},
+		{name: "single pixel", r: image.Rect(3, 3, 4, 4)},
+		{name: "empty", r: image.Rect(20, 20, 20, 30)},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := CropMask(48, 64, tc.r)
+			defer got.Close()
+			want := cropMaskLoop(48, 64, tc.r)
+			defer want.Close()
+			compareMats(t, got, want)
+		})
+	}
+}
+
+func TestCropsMask(t *testing.T) {
+	cases := []struct {
+		name    string
+		crops   []settings.Crop
+		inside  []image.Point
+		outside []image.Point
+	}{
+		{
+			name: "two columns",
+			crops: []settings.Crop{
+				{Shape: mask.CropRectangle, Left: 0, Top: 10, Right: 20, Bottom: 40},
+				{Shape: mask.CropRectangle, Left: 40, Top: 10, Right: 60, Bottom: 40},
+			},
+			inside:  []image.Point{{0, 10}, {19, 39}, {40, 10}, {59, 39}},
+			outside: []image.Point{{30, 20}, {20, 20}, {10, 9}, {50, 40}},
+		},
+		{
+			name: "swapped corners",
+			crops: []settings.Crop{
+				{Shape: mask.CropRectangle, Left: 20, Top: 40, Right: 0, Bottom: 10},
+			},
+			inside:  []image.Point{{0, 10}, {19, 39}},
+			outside: []image.Point{{20, 20}, {10, 40}},
+		},
+		{
+			name: "ellipse",
+			crops: []settings.Crop{
+				{Shape: mask.CropEllipse, Left: 10, Top: 10, Right: 50, Bottom: 30},
+			},
+			inside:  []image.Point{{30, 20}, {12, 20}, {30, 11}},
+			outside: []image.Point{{11, 11}, {49, 29}, {5, 20}},
+		},
+		{
+			name: "triangle",
+			crops: []settings.Crop{
+				{Shape: mask.CropPolygon, Points: []image.Point{{0, 0}, {63, 0}, {0, 47}}},
+			},
+			inside:  []image.Point{{1, 1}, {30, 10}, {5, 40}},
+			outside: []image.Point{{63, 47}, {40, 30}},
+		},
+		{
+			name: "polygon with too few points",
+			crops: []settings.Crop{
+				{Shape: mask.CropPolygon, Points: []image.Point{{0, 0}, {63, 47}}},
+			},
+			outside: []image.Point{{0, 0}, {30, 22}},
+		},
+		{
+			name: "outside the frame",
+			crops: []settings.Crop{
+				{Shape: mask.CropRectangle, Left: 50, Top: 40, Right: 100, Bottom: 100},
+			},
+			inside:  []image.Point{{50, 40}, {63, 47}},
+			outside: []image.Point{{49, 47}},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			m := CropsMask(48, 64, tc.crops)
+			defer m.Close()
+			for _, p := range tc.inside {
+				if got := m.GetUCharAt(p.Y, p.X); got != 255 {
+					t.Errorf("mask at %v = %d, want 255", p, got)
+				}
+			}
+			for _, p := range tc.outside {
+				if got := m.GetUCharAt(p.Y, p.X); got != 0 {
+					t.Errorf("mask at %v = %d, want 0", p, got)
+				}
+			}
+		})
+	}
+}
+
+var benchmarkSizes = []struct {
+	name          string
+	width, height int
+}{
+	{name: "720p", width: 1280, height: 720},
+	{name: "1080p", width: 1920, height: 1080},
+	{name: "4K", width: 3840, height: 2160},
+}
+
+func BenchmarkCropMask(b *testing.B) {
+	for _, size := range benchmarkSizes {
+		// A typical lower-third crop.
+		r := image.Rect(size.width/10, size.height*2/3, size.width*9/10, size.height*9/10)
+		b.Run(size.name+"/rect", func(b *testing.B) {
+			for b.Loop() {
+				m := CropMask(size.height, size.width, r)
+				m.Close()
+			}
+		})
+		b.Run(size.name+"/loop", func(b *testing.B) {
+			for b.Loop() {
+				m := cropMaskLoop(size.height, size.width, r)
+				m.Close()
+			}
+		})
+	}
+}
+
+func BenchmarkRenderMask(b *testing.B) {
+	for _, size := range benchmarkSizes {
+		b.Run(size.name, func(b *testing.B) {
+			frame := gocv.NewMatWithSizeFromScalar(gocv.NewScalar(40, 200, 220, 0), size.height, size.width, gocv.MatTypeCV8UC3)
+			defer frame.Close()
+			dst := gocv.NewMat()
+			defer dst.Close()
+			s := settings.Mask{
+				Min:        [3]int{0, 0, 200},
+				Max:        [3]int{179, 255, 255},
+				Grow:       3,
+				CropLeft:   size.width / 10,
+				CropTop:    size.height * 2 / 3,
+				CropRight:  size.width * 9 / 10,
+				CropBottom: size.height * 9 / 10,
+			}
+			for b.Loop() {
+				RenderMask(frame, &dst, s)
+			}
+		})
+	}
+}
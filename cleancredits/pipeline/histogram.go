@@ -0,0 +1,53 @@
+package pipeline
+
+import (
+	"fmt"
+	"reflect"
+
+	"gocv.io/x/gocv"
+
+	"github.com/sandalwoodbox/go-cleancredits/cleancredits/mask"
+	"github.com/sandalwoodbox/go-cleancredits/cleancredits/settings"
+)
+
+// CropHistograms counts the values of each channel of frame, in the color
+// space of ms, for the pixels inside the crop of ms. Each histogram has one
+// count for every value from 0 to the channel's maximum.
+func CropHistograms(frame gocv.Mat, ms settings.Mask) [3][]int {
+	converted := gocv.NewMat()
+	defer converted.Close()
+	ConvertColor(frame, &converted, ms.ColorSpace)
+	crop := maskCrop(frame.Rows(), frame.Cols(), ms)
+	defer crop.Close()
+
+	ch := mask.ColorSpaceChannels(ms.ColorSpace)
+	hist := gocv.NewMat()
+	defer hist.Close()
+	var hists [3][]int
+	for c := range hists {
+		// Values can only be out of range for hues, and aren't counted.
+		n := ch.Max[c] + 1
+		err := gocv.CalcHist([]gocv.Mat{converted}, []int{c}, crop, &hist, []int{n}, []float64{0, float64(n)}, false)
+		if err != nil {
+			fmt.Println("Error calculating histogram: ", err)
+			continue
+		}
+		hists[c] = make([]int, n)
+		for v := range hists[c] {
+			hists[c][v] = int(hist.GetFloatAt(v, 0))
+		}
+	}
+	return hists
+}
+
+// histogramSettingsChanged returns true if ms would give different
+// histograms than the last rendered mask settings.
+func (p Pipeline) histogramSettingsChanged(ms settings.Mask) bool {
+	old := p.MaskSettings
+	return ms.ColorSpace != old.ColorSpace ||
+		ms.CropLeft != old.CropLeft ||
+		ms.CropTop != old.CropTop ||
+		ms.CropRight != old.CropRight ||
+		ms.CropBottom != old.CropBottom ||
+		!reflect.DeepEqual(ms.Crops, old.Crops)
+}
@@ -0,0 +1,77 @@
+package pipeline
+
+import (
+	"image"
+	"testing"
+
+	"gocv.io/x/gocv"
+
+	"github.com/sandalwoodbox/go-cleancredits/cleancredits/mask"
+	"github.com/sandalwoodbox/go-cleancredits/cleancredits/settings"
+)
+
+func TestCropHistograms(t *testing.T) {
+	// Grey 100 on the left half and grey 200 on the right half.
+	frame := gocv.NewMatWithSizeFromScalar(gocv.NewScalar(100, 100, 100, 0), 4, 4, gocv.MatTypeCV8UC3)
+	defer frame.Close()
+	right := frame.Region(image.Rect(2, 0, 4, 4))
+	right.SetTo(gocv.NewScalar(200, 200, 200, 0))
+	right.Close()
+
+	cases := []struct {
+		name         string
+		ms           settings.Mask
+		dark, bright int
+	}{
+		{
+			name:   "whole frame",
+			ms:     settings.Mask{CropRight: 4, CropBottom: 4},
+			dark:   8,
+			bright: 8,
+		},
+		{
+			name:   "left half",
+			ms:     settings.Mask{CropRight: 2, CropBottom: 4},
+			dark:   8,
+			bright: 0,
+		},
+		{
+			name: "overlapping crops are counted once",
+			ms: settings.Mask{Crops: []settings.Crop{
+				{Shape: mask.CropRectangle, Left: 1, Top: 0, Right: 3, Bottom: 1},
+				{Shape: mask.CropRectangle, Left: 2, Top: 0, Right: 4, Bottom: 1},
+			}},
+			dark:   1,
+			bright: 2,
+		},
+		{
+			name:   "empty crop",
+			ms:     settings.Mask{},
+			dark:   0,
+			bright: 0,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			hists := CropHistograms(frame, tc.ms)
+			for c, want := range []int{mask.HueMax + 1, mask.SatMax + 1, mask.ValMax + 1} {
+				if len(hists[c]) != want {
+					t.Errorf("histogram %d has %d values, want %d", c, len(hists[c]), want)
+				}
+			}
+			// Greys have no hue or saturation.
+			if got, want := hists[0][0], tc.dark+tc.bright; got != want {
+				t.Errorf("hue 0 count = %d, want %d", got, want)
+			}
+			if got, want := hists[1][0], tc.dark+tc.bright; got != want {
+				t.Errorf("sat 0 count = %d, want %d", got, want)
+			}
+			if got := hists[2][100]; got != tc.dark {
+				t.Errorf("val 100 count = %d, want %d", got, tc.dark)
+			}
+			if got := hists[2][200]; got != tc.bright {
+				t.Errorf("val 200 count = %d, want %d", got, tc.bright)
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package pipeline
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+
+	"gocv.io/x/gocv"
+
+	"github.com/sandalwoodbox/go-cleancredits/cleancredits/settings"
+)
+
+// videoCaptureLRFHasKeyFrame is OpenCV's CAP_PROP_LRF_HAS_KEY_FRAME, which
+// gocv doesn't define. It reports whether the last raw packet read was a
+// keyframe, and is only supported by the FFmpeg backend in raw mode.
+const videoCaptureLRFHasKeyFrame gocv.VideoCaptureProperties = 67
+
+// SeekIndex records the timestamp of every frame in a video and which frames
+// are keyframes. With long-GOP codecs, seeking straight to a frame number can
+// land on the wrong frame; the index allows FrameCache to seek to a keyframe
+// and decode forward instead, checking timestamps to be sure that it returns
+// exactly the frame that was asked for.
+type SeekIndex struct {
+	// Timestamps holds the presentation timestamp (in milliseconds) of each
+	// frame, in presentation order.
+	Timestamps []float64
+	// Keyframes holds the numbers of the frames that decoding can start
+	// from, in ascending order.
+	Keyframes []int
+
+	// tolerance is how far apart two timestamps can be while still referring
+	// to the same frame.
+	tolerance float64
+}
+
+// IndexSource builds a SeekIndex for src. It returns nil for sources that
+// can already seek to an exact frame, such as image sequences.
+func IndexSource(src settings.Source) (*SeekIndex, error) {
+	if src.Kind != SourceVideo {
+		return nil, nil
+	}
+	return BuildSeekIndex(src.Path)
+}
+
+// BuildSeekIndex reads every packet of the video at path without decoding
+// it, recording timestamps and keyframes.
+func BuildSeekIndex(path string) (*SeekIndex, error) {
+	vc, err := gocv.VideoCaptureFileWithAPIParams(
+		path,
+		gocv.VideoCaptureFFmpeg,
+		// Return raw packets instead of decoded frames.
+		[]gocv.VideoCaptureProperties{gocv.VideoCaptureFormat, -1},
+	)
+	if err != nil {
+		vc.Close()
+		return nil, fmt.Errorf("opening %s: %v", path, err)
+	}
+	defer vc.Close()
+
+	type packet struct {
+		timestamp float64
+		keyframe  bool
+	}
+	var packets []packet
+	raw := gocv.NewMat()
+	defer raw.Close()
+	for vc.Read(&raw) {
+		packets = append(packets, packet{
+			timestamp: vc.Get(gocv.VideoCapturePosMsec),
+			keyframe:  vc.Get(videoCaptureLRFHasKeyFrame) != 0,
+		})
+	}
+	if len(packets) == 0 {
+		return nil, fmt.Errorf("no frames found in %s", path)
+	}
+
+	// Packets are read in decode order, which differs from presentation
+	// order when the video has B-frames.
+	slices.SortStableFunc(packets, func(a, b packet) int {
+		switch {
+		case a.timestamp < b.timestamp:
+			return -1
+		case a.timestamp > b.timestamp:
+			return 1
+		}
+		return 0
+	})
+	si := &SeekIndex{tolerance: math.Inf(1)}
+	for i, p := range packets {
+		if i > 0 {
+			gap := p.timestamp - packets[i-1].timestamp
+			if gap <= 0 {
+				return nil, fmt.Errorf("frames %d and %d have the same timestamp", i-1, i)
+			}
+			si.tolerance = min(si.tolerance, gap/2)
+		}
+		si.Timestamps = append(si.Timestamps, p.timestamp)
+		if p.keyframe {
+			si.Keyframes = append(si.Keyframes, i)
+		}
+	}
+	if len(si.Keyframes) == 0 || si.Keyframes[0] != 0 {
+		// Decoding can always start from the beginning of the video.
+		si.Keyframes = append([]int{0}, si.Keyframes...)
+	}
+	return si, nil
+}
+
+// FrameCount returns the number of frames in the index.
+func (si *SeekIndex) FrameCount() int {
+	return len(si.Timestamps)
+}
+
+// KeyframeBefore returns the last keyframe at or before frame n.
+func (si *SeekIndex) KeyframeBefore(n int) int {
+	i := sort.SearchInts(si.Keyframes, n+1)
+	if i == 0 {
+		return 0
+	}
+	return si.Keyframes[i-1]
+}
+
+// FrameAt returns the number of the frame with the given timestamp, or -1 if
+// no frame has that timestamp.
+func (si *SeekIndex) FrameAt(timestamp float64) int {
+	i := sort.SearchFloat64s(si.Timestamps, timestamp)
+	for _, c := range []int{i - 1, i} {
+		if c >= 0 && c < len(si.Timestamps) && math.Abs(si.Timestamps[c]-timestamp) <= si.tolerance {
+			return c
+		}
+	}
+	return -1
+}
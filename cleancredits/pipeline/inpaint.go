@@ -0,0 +1,103 @@
+package pipeline
+
+import (
+	"context"
+	"hash/fnv"
+	"image"
+
+	"gocv.io/x/gocv"
+)
+
+// InpaintCacheBytes is the memory budget for cached inpainted frames.
+const InpaintCacheBytes = 256 << 20
+
+// inpaintKey identifies an inpainted frame. mask is a hash of the mask that
+// was used (see HashMask), scale is the scale of the frame and mask, and
+// radius is the inpaint radius after scaling, so changing any of them misses
+// the cache.
+type inpaintKey struct {
+	frame  int
+	scale  float64
+	mask   uint64
+	radius int
+}
+
+// HashMask returns a hash of the contents of mask.
+func HashMask(mask gocv.Mat) uint64 {
+	h := fnv.New64a()
+	h.Write(mask.ToBytes())
+	return h.Sum64()
+}
+
+// Inpaint fills the areas of src selected by mask using the Telea method,
+// like gocv.Inpaint. Instead of processing the whole frame, it only inpaints
+// the regions around the mask's bounding boxes and copies the results into
+// dst, which gives the same output much faster for small masks.
+func Inpaint(src, mask gocv.Mat, dst *gocv.Mat, radius int) {
+	InpaintWithRegions(src, mask, dst, radius, InpaintRegions(mask, radius))
+}
+
+// InpaintWithRegions is like Inpaint, but takes the regions from an earlier
+// call to InpaintRegions. This saves finding them again when the same mask
+// is applied to many frames.
+func InpaintWithRegions(src, mask gocv.Mat, dst *gocv.Mat, radius int, regions []image.Rectangle) {
+	inpaintWithRegions(context.Background(), src, mask, dst, radius, regions)
+}
+
+// inpaintWithRegions is InpaintWithRegions, but it stops between regions if
+// ctx is cancelled and returns ctx.Err(), leaving dst partly inpainted.
+func inpaintWithRegions(ctx context.Context, src, mask gocv.Mat, dst *gocv.Mat, radius int, regions []image.Rectangle) error {
+	src.CopyTo(dst)
+	for _, r := range regions {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		srcROI := src.Region(r)
+		maskROI := mask.Region(r)
+		out := gocv.NewMat()
+		gocv.Inpaint(srcROI, maskROI, &out, float32(radius), gocv.Telea)
+		dstROI := dst.Region(r)
+		out.CopyTo(&dstROI)
+		dstROI.Close()
+		out.Close()
+		maskROI.Close()
+		srcROI.Close()
+	}
+	return nil
+}
+
+// InpaintRegions returns the areas of the frame that inpainting with the
+// given radius reads from or writes to: the bounding box of each part of
+// mask, padded by the radius. Overlapping boxes are merged, so that each
+// region can be inpainted independently.
+func InpaintRegions(mask gocv.Mat, radius int) []image.Rectangle {
+	// OpenCV clamps the radius to 1-100. Telea also looks at the neighbours of
+	// the pixels within the radius, so allow a little extra.
+	pad := min(max(radius, 1), 100) + 2
+	bounds := image.Rect(0, 0, mask.Cols(), mask.Rows())
+
+	contours := gocv.FindContours(mask, gocv.RetrievalExternal, gocv.ChainApproxSimple)
+	defer contours.Close()
+	var regions []image.Rectangle
+	for i := 0; i < contours.Size(); i++ {
+		r := gocv.BoundingRect(contours.At(i)).Inset(-pad).Intersect(bounds)
+		regions = append(regions, r)
+	}
+
+	// Merging two boxes can make the result overlap another box, so repeat
+	// until nothing changes.
+	for merged := true; merged; {
+		merged = false
+		for i := 0; i < len(regions); i++ {
+			for j := i + 1; j < len(regions); j++ {
+				if regions[i].Overlaps(regions[j]) {
+					regions[i] = regions[i].Union(regions[j])
+					regions = append(regions[:j], regions[j+1:]...)
+					merged = true
+					j--
+				}
+			}
+		}
+	}
+	return regions
+}
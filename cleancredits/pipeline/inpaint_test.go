@@ -0,0 +1,91 @@
+package pipeline
+
+import (
+	"image"
+	"path"
+	"testing"
+
+	"gocv.io/x/gocv"
+)
+
+// lowerThirdMask returns a mask with a few blocks of "text" in the lower third
+// of a frame, as well as one touching the edge of the frame.
+func lowerThirdMask(width, height int) gocv.Mat {
+	m := gocv.Zeros(height, width, gocv.MatTypeCV8U)
+	blocks := []image.Rectangle{
+		image.Rect(width/10, height*3/4, width*3/10, height*4/5),
+		image.Rect(width*4/10, height*3/4, width*6/10, height*4/5),
+		image.Rect(width/4, height*5/6, width*3/4, height*7/8),
+		image.Rect(width-width/20, height/20, width, height/10),
+	}
+	for _, b := range blocks {
+		roi := m.Region(b)
+		roi.SetTo(gocv.NewScalar(255, 0, 0, 0))
+		roi.Close()
+	}
+	return m
+}
+
+func TestInpaint(t *testing.T) {
+	vc, err := gocv.VideoCaptureFile("testdata/horses-720p.mp4")
+	if err != nil {
+		t.Fatalf("Error loading video file: %v", err)
+	}
+	defer vc.Close()
+	frame := gocv.NewMat()
+	defer frame.Close()
+	if !vc.Read(&frame) {
+		t.Fatalf("Error loading frame")
+	}
+
+	horsesMask := gocv.IMRead(path.Join("testdata", "horses-720p-mask.png"), gocv.IMReadGrayScale)
+	defer horsesMask.Close()
+	textMask := lowerThirdMask(frame.Cols(), frame.Rows())
+	defer textMask.Close()
+	emptyMask := gocv.Zeros(frame.Rows(), frame.Cols(), gocv.MatTypeCV8U)
+	defer emptyMask.Close()
+
+	cases := []struct {
+		name   string
+		mask   gocv.Mat
+		radius int
+	}{
+		{name: "horses", mask: horsesMask, radius: 3},
+		{name: "text", mask: textMask, radius: 3},
+		{name: "text radius 0", mask: textMask, radius: 0},
+		{name: "text radius 10", mask: textMask, radius: 10},
+		{name: "empty", mask: emptyMask, radius: 3},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			want := gocv.NewMat()
+			defer want.Close()
+			gocv.Inpaint(frame, tc.mask, &want, float32(tc.radius), gocv.Telea)
+			got := gocv.NewMat()
+			defer got.Close()
+			Inpaint(frame, tc.mask, &got, tc.radius)
+			compareMats(t, got, want)
+		})
+	}
+}
+
+func BenchmarkInpaint(b *testing.B) {
+	for _, size := range benchmarkSizes {
+		frame := gocv.NewMatWithSizeFromScalar(gocv.NewScalar(40, 200, 220, 0), size.height, size.width, gocv.MatTypeCV8UC3)
+		mask := lowerThirdMask(size.width, size.height)
+		dst := gocv.NewMat()
+		b.Run(size.name+"/roi", func(b *testing.B) {
+			for b.Loop() {
+				Inpaint(frame, mask, &dst, 3)
+			}
+		})
+		b.Run(size.name+"/full", func(b *testing.B) {
+			for b.Loop() {
+				gocv.Inpaint(frame, mask, &dst, 3, gocv.Telea)
+			}
+		})
+		dst.Close()
+		mask.Close()
+		frame.Close()
+	}
+}
@@ -0,0 +1,117 @@
+package pipeline
+
+import (
+	"fmt"
+	"image"
+	"math"
+
+	"gocv.io/x/gocv"
+)
+
+// The steps of RenderMask that can decide whether a pixel is masked.
+const (
+	StepColor      = "Color"
+	StepComponents = "Components"
+	StepMorphology = "Morphology"
+	StepCrop       = "Crop"
+)
+
+// PixelInfo describes a pixel of the preview.
+type PixelInfo struct {
+	// X and Y are the position of the pixel in video pixels.
+	X, Y int
+	BGR  [3]uint8
+	HSV  [3]uint8
+	// Masked is true if the pixel will be inpainted.
+	Masked bool
+	// Step is the step of the mask that decided Masked: StepCrop if the pixel
+	// is outside the crop, StepMorphology if Grow, Shrink, Open or Close
+	// changed it, StepComponents if its connected component was filtered
+	// out, and StepColor otherwise. Masks don't have layers yet (see the
+	// TODOs in UpdateMask), so this stands in for the layer the pixel comes
+	// from.
+	Step string
+}
+
+// InspectPixel returns the values of the pixel at pt in frame, and whether
+// the mask rendered as stages covers it.
+func InspectPixel(frame gocv.Mat, stages MaskStages, pt image.Point) (PixelInfo, error) {
+	if !pt.In(image.Rect(0, 0, frame.Cols(), frame.Rows())) ||
+		!pt.In(image.Rect(0, 0, stages.Crop.Cols(), stages.Crop.Rows())) {
+		return PixelInfo{}, fmt.Errorf("%v is outside the frame", pt)
+	}
+	info := PixelInfo{X: pt.X, Y: pt.Y}
+	bgr := frame.Region(image.Rect(pt.X, pt.Y, pt.X+1, pt.Y+1))
+	defer bgr.Close()
+	copy(info.BGR[:], bgr.ToBytes())
+	hsv := gocv.NewMat()
+	defer hsv.Close()
+	gocv.CvtColor(bgr, &hsv, gocv.ColorBGRToHSV)
+	copy(info.HSV[:], hsv.ToBytes())
+
+	switch {
+	case stages.Crop.GetUCharAt(pt.Y, pt.X) == 0:
+		info.Step = StepCrop
+	case stages.Filtered.GetUCharAt(pt.Y, pt.X) != stages.Morphed.GetUCharAt(pt.Y, pt.X):
+		info.Step = StepMorphology
+		info.Masked = stages.Morphed.GetUCharAt(pt.Y, pt.X) != 0
+	case stages.Color.GetUCharAt(pt.Y, pt.X) != stages.Filtered.GetUCharAt(pt.Y, pt.X):
+		info.Step = StepComponents
+	default:
+		info.Step = StepColor
+		info.Masked = stages.Color.GetUCharAt(pt.Y, pt.X) != 0
+	}
+	return info, nil
+}
+
+// Inspect returns the pixel at x, y (in video pixels) of the frame shown by
+// the last preview, and whether the current mask covers it.
+func (p *Pipeline) Inspect(x, y float64) (PixelInfo, error) {
+	p.displayLock.Lock()
+	n := p.viewFrame
+	p.displayLock.Unlock()
+
+	p.stagesLock.Lock()
+	defer p.stagesLock.Unlock()
+	if p.stages == nil || n < 0 {
+		return PixelInfo{}, fmt.Errorf("mask has not been rendered")
+	}
+	scale := p.stagesScale
+	frame, err := p.loadPreviewFrame(n, scale)
+	if err != nil {
+		return PixelInfo{}, fmt.Errorf("loading frame %d: %v", n, err)
+	}
+	defer frame.Close()
+	pt := image.Pt(int(math.Floor(x*scale)), int(math.Floor(y*scale)))
+	info, err := InspectPixel(frame, *p.stages, pt)
+	if err != nil {
+		return PixelInfo{}, err
+	}
+	info.X, info.Y = int(math.Floor(x)), int(math.Floor(y))
+	return info, nil
+}
+
+// String describes the pixel for the status bar.
+func (i PixelInfo) String() string {
+	var decision string
+	switch {
+	case i.Masked && i.Step == StepMorphology:
+		decision = "masked by grow or close"
+	case i.Masked:
+		decision = "masked by color"
+	case i.Step == StepMorphology:
+		decision = "not masked: removed by shrink or open"
+	case i.Step == StepComponents:
+		decision = "not masked: component filtered out"
+	case i.Step == StepCrop:
+		decision = "not masked: outside the crop"
+	default:
+		decision = "not masked by color"
+	}
+	return fmt.Sprintf("(%d, %d)  BGR %d, %d, %d  HSV %d, %d, %d  %s",
+		i.X, i.Y,
+		i.BGR[0], i.BGR[1], i.BGR[2],
+		i.HSV[0], i.HSV[1], i.HSV[2],
+		decision,
+	)
+}
@@ -0,0 +1,68 @@
+package pipeline
+
+import (
+	"image"
+	"testing"
+
+	"github.com/sandalwoodbox/go-cleancredits/cleancredits/settings"
+)
+
+func TestInspectPixel(t *testing.T) {
+	// White, black, black, black and white, in BGR order.
+	frame := sliceToHSVMat([][][]uint8{
+		{
+			{255, 255, 255},
+			{0, 0, 0},
+			{0, 0, 0},
+			{0, 0, 0},
+			{255, 255, 255},
+		},
+	})
+	defer frame.Close()
+	// Select white, grown by a pixel each way, but not the last column.
+	ms := settings.Mask{
+		Min:        [3]int{0, 0, 200},
+		Max:        [3]int{179, 30, 255},
+		Grow:       3,
+		CropRight:  4,
+		CropBottom: 1,
+	}
+	cases := []struct {
+		x      int
+		masked bool
+		step   string
+	}{
+		{x: 0, masked: true, step: StepColor},
+		{x: 1, masked: true, step: StepMorphology},
+		{x: 2, masked: false, step: StepColor},
+		{x: 3, masked: true, step: StepMorphology},
+		{x: 4, masked: false, step: StepCrop},
+	}
+	stages := RenderMaskStages(frame, ms)
+	defer stages.Close()
+	for _, tc := range cases {
+		info, err := InspectPixel(frame, stages, image.Pt(tc.x, 0))
+		if err != nil {
+			t.Fatalf("InspectPixel(%d) returned error: %v", tc.x, err)
+		}
+		if info.Masked != tc.masked || info.Step != tc.step {
+			t.Errorf("InspectPixel(%d) = masked %t by %s, want masked %t by %s", tc.x, info.Masked, info.Step, tc.masked, tc.step)
+		}
+	}
+
+	info, err := InspectPixel(frame, stages, image.Pt(0, 0))
+	if err != nil {
+		t.Fatalf("InspectPixel returned error: %v", err)
+	}
+	if want := [3]uint8{255, 255, 255}; info.BGR != want {
+		t.Errorf("BGR = %v, want %v", info.BGR, want)
+	}
+	if want := [3]uint8{0, 0, 255}; info.HSV != want {
+		t.Errorf("HSV = %v, want %v", info.HSV, want)
+	}
+
+	_, err = InspectPixel(frame, stages, image.Pt(5, 0))
+	if err == nil {
+		t.Error("InspectPixel outside the frame didn't return an error")
+	}
+}
@@ -0,0 +1,42 @@
+package pipeline
+
+import (
+	"image"
+
+	"gocv.io/x/gocv"
+
+	"github.com/sandalwoodbox/go-cleancredits/cleancredits/mask"
+	"github.com/sandalwoodbox/go-cleancredits/cleancredits/settings"
+)
+
+// morphShapes converts kernel shapes to OpenCV's. Unknown shapes are treated
+// as rectangles.
+var morphShapes = map[string]gocv.MorphShape{
+	mask.KernelRectangle: gocv.MorphRect,
+	mask.KernelEllipse:   gocv.MorphEllipse,
+	mask.KernelCross:     gocv.MorphCross,
+}
+
+// Morph applies the morphological operations of s to src: Open removes
+// specks, Close fills gaps, then the result is shrunk by Shrink and grown by
+// Grow. Each is skipped if its size is 0.
+func Morph(src gocv.Mat, dst *gocv.Mat, s settings.Mask) {
+	src.CopyTo(dst)
+	shape := morphShapes[s.Kernel]
+	for _, op := range []struct {
+		size int
+		fn   func(kernel gocv.Mat)
+	}{
+		{s.Open, func(kernel gocv.Mat) { gocv.MorphologyEx(*dst, dst, gocv.MorphOpen, kernel) }},
+		{s.Close, func(kernel gocv.Mat) { gocv.MorphologyEx(*dst, dst, gocv.MorphClose, kernel) }},
+		{s.Shrink, func(kernel gocv.Mat) { gocv.Erode(*dst, dst, kernel) }},
+		{s.Grow, func(kernel gocv.Mat) { gocv.Dilate(*dst, dst, kernel) }},
+	} {
+		if op.size <= 0 {
+			continue
+		}
+		kernel := gocv.GetStructuringElement(shape, image.Pt(op.size, op.size))
+		op.fn(kernel)
+		kernel.Close()
+	}
+}
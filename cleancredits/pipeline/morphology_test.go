@@ -0,0 +1,86 @@
+package pipeline
+
+import (
+	"testing"
+
+	"gocv.io/x/gocv"
+
+	"github.com/sandalwoodbox/go-cleancredits/cleancredits/mask"
+	"github.com/sandalwoodbox/go-cleancredits/cleancredits/settings"
+)
+
+func TestMorph(t *testing.T) {
+	dot := [][]uint8{
+		{0, 0, 0, 0, 0},
+		{0, 0, 0, 0, 0},
+		{0, 0, 255, 0, 0},
+		{0, 0, 0, 0, 0},
+		{0, 0, 0, 0, 0},
+	}
+	square := [][]uint8{
+		{0, 0, 0, 0, 0},
+		{0, 255, 255, 255, 0},
+		{0, 255, 255, 255, 0},
+		{0, 255, 255, 255, 0},
+		{0, 0, 0, 0, 0},
+	}
+	cross := [][]uint8{
+		{0, 0, 0, 0, 0},
+		{0, 0, 255, 0, 0},
+		{0, 255, 255, 255, 0},
+		{0, 0, 255, 0, 0},
+		{0, 0, 0, 0, 0},
+	}
+	empty := [][]uint8{
+		{0, 0, 0, 0, 0},
+		{0, 0, 0, 0, 0},
+		{0, 0, 0, 0, 0},
+		{0, 0, 0, 0, 0},
+		{0, 0, 0, 0, 0},
+	}
+	cases := []struct {
+		name string
+		src  [][]uint8
+		ms   settings.Mask
+		want [][]uint8
+	}{
+		{name: "nothing", src: dot, ms: settings.Mask{}, want: dot},
+		{name: "grow", src: dot, ms: settings.Mask{Grow: 3}, want: square},
+		{name: "grow with a cross", src: dot, ms: settings.Mask{Grow: 3, Kernel: mask.KernelCross}, want: cross},
+		{name: "grow with a rectangle", src: dot, ms: settings.Mask{Grow: 3, Kernel: mask.KernelRectangle}, want: square},
+		{name: "shrink", src: square, ms: settings.Mask{Shrink: 3}, want: dot},
+		{name: "open removes specks", src: dot, ms: settings.Mask{Open: 3}, want: empty},
+		{name: "open keeps blocks", src: square, ms: settings.Mask{Open: 3}, want: square},
+		{name: "shrink before grow", src: dot, ms: settings.Mask{Shrink: 3, Grow: 3}, want: empty},
+		{
+			name: "close fills gaps",
+			src: [][]uint8{
+				{0, 0, 0, 0, 0, 0, 0, 0, 0},
+				{0, 0, 0, 0, 0, 0, 0, 0, 0},
+				{0, 0, 255, 255, 0, 255, 255, 0, 0},
+				{0, 0, 0, 0, 0, 0, 0, 0, 0},
+				{0, 0, 0, 0, 0, 0, 0, 0, 0},
+			},
+			ms: settings.Mask{Close: 3},
+			want: [][]uint8{
+				{0, 0, 0, 0, 0, 0, 0, 0, 0},
+				{0, 0, 0, 0, 0, 0, 0, 0, 0},
+				{0, 0, 255, 255, 255, 255, 255, 0, 0},
+				{0, 0, 0, 0, 0, 0, 0, 0, 0},
+				{0, 0, 0, 0, 0, 0, 0, 0, 0},
+			},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			src := sliceToGrayscaleMat(tc.src)
+			defer src.Close()
+			want := sliceToGrayscaleMat(tc.want)
+			defer want.Close()
+			got := gocv.NewMat()
+			defer got.Close()
+			Morph(src, &got, tc.ms)
+			compareMats(t, got, want)
+		})
+	}
+}
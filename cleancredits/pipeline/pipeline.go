@@ -1,10 +1,15 @@
 package pipeline
 
 import (
+	"context"
 	"fmt"
 	"image"
+	"reflect"
+	"slices"
 	"strconv"
+	"sync"
 
+	lru "github.com/hashicorp/golang-lru/v2"
 	"gocv.io/x/gocv"
 
 	"github.com/sandalwoodbox/go-cleancredits/cleancredits/display"
@@ -12,12 +17,15 @@ import (
 )
 
 type Pipeline struct {
-	VideoCapture  *gocv.VideoCapture
-	FrameCache    *FrameCache
-	VideoWidth    int
-	VideoHeight   int
-	DisplayWidth  int
-	DisplayHeight int
+	Source       settings.Source
+	Capture      Capture
+	Index        *SeekIndex
+	FrameCache   *FrameCache
+	proxyCache   *lru.Cache[proxyKey, gocv.Mat]
+	proxyLock    *sync.Mutex
+	inpaintCache *lru.Cache[inpaintKey, gocv.Mat]
+	VideoWidth   int
+	VideoHeight  int
 
 	// Cached images
 	Mask              *image.Image
@@ -25,6 +33,13 @@ type Pipeline struct {
 	MaskWithOverrides *image.Image
 	Display           gocv.Mat
 	Zoomed            gocv.Mat
+	// MaskScale is the scale of the cached masks relative to the source. It
+	// is less than 1 when the preview uses proxy frames.
+	MaskScale float64
+	// MaskHash is the HashMask of MaskWithOverrides.
+	MaskHash uint64
+	// Histograms are the CropHistograms of the mask frame, at MaskScale.
+	Histograms [3][]int
 
 	// Last rendered settings
 	DisplayFrameNumber int
@@ -32,26 +47,76 @@ type Pipeline struct {
 	DrawSettings       settings.Draw
 	DisplaySettings    settings.Display
 	RenderSettings     settings.Render
+	// displayMask is the mask that Display was rendered with.
+	displayMask *image.Image
+	// ZoomedSize is the display size that Zoomed was rendered for.
+	ZoomedSize image.Point
+	// ZoomRect is the part of the source shown in Zoomed, in video pixels.
+	ZoomRect image.Rectangle
 
-	// Partial render status
-	MaskChanged bool
+	// maskLock guards the cached masks, MaskScale, MaskHash, Histograms and
+	// MaskSettings. UpdateMask replaces them while ApplyMask, FullMask and
+	// the UI read them.
+	maskLock *sync.Mutex
+
+	// displayLock guards the fields below, which the UI reads and writes
+	// while masks and previews are rendered in the background.
+	displayLock   *sync.Mutex
+	displayWidth  int
+	displayHeight int
+	// viewRect and viewZoom are ZoomRect and the zoom of the last preview
+	// that ApplyMask returned.
+	viewRect image.Rectangle
+	viewZoom float64
+	// viewFrame is the frame shown by that preview.
+	viewFrame int
+
+	// stagesLock guards the MaskStages of the current mask, which Inspect
+	// reads while UpdateMask replaces them.
+	stagesLock  *sync.Mutex
+	stages      *MaskStages
+	stagesScale float64
 }
 
-func NewPipeline(vc *gocv.VideoCapture, displayWidth, displayHeight int) (*Pipeline, error) {
+// NewPipeline returns a Pipeline that loads frames from vc. index may be nil
+// if the source doesn't need one (see IndexSource).
+func NewPipeline(src settings.Source, vc Capture, index *SeekIndex, cacheOpts CacheOptions, displayWidth, displayHeight int) (*Pipeline, error) {
 	w := int(vc.Get(gocv.VideoCaptureFrameWidth))
 	h := int(vc.Get(gocv.VideoCaptureFrameHeight))
-	cache, err := NewFrameCache(vc, false)
+	cache, err := NewFrameCache(vc, index, cacheOpts, false)
 	if err != nil {
 		return nil, fmt.Errorf("creating frame cache: %v", err)
 	}
+	proxyCache, err := lru.NewWithEvict(ProxyCacheFrames, func(k proxyKey, v gocv.Mat) {
+		v.Close()
+	})
+	if err != nil {
+		return nil, fmt.Errorf("creating proxy cache: %v", err)
+	}
+	inpaintCache, err := lru.NewWithEvict(CacheSize(InpaintCacheBytes, w, h), func(k inpaintKey, v gocv.Mat) {
+		v.Close()
+	})
+	if err != nil {
+		return nil, fmt.Errorf("creating inpaint cache: %v", err)
+	}
 	return &Pipeline{
-		VideoCapture:       vc,
+		Source:             src,
+		Capture:            vc,
+		Index:              index,
 		FrameCache:         cache,
+		proxyCache:         proxyCache,
+		proxyLock:          &sync.Mutex{},
+		inpaintCache:       inpaintCache,
 		VideoWidth:         w,
 		VideoHeight:        h,
-		DisplayWidth:       displayWidth,
-		DisplayHeight:      displayHeight,
+		displayLock:        &sync.Mutex{},
+		displayWidth:       displayWidth,
+		displayHeight:      displayHeight,
+		viewFrame:          -1,
+		stagesLock:         &sync.Mutex{},
+		maskLock:           &sync.Mutex{},
 		DisplayFrameNumber: -1,
+		MaskScale:          1,
 		Display:            gocv.NewMat(),
 		Zoomed:             gocv.NewMat(),
 		MaskSettings:       settings.Mask{Frame: -1},
@@ -61,120 +126,328 @@ func NewPipeline(vc *gocv.VideoCapture, displayWidth, displayHeight int) (*Pipel
 	}, nil
 }
 
-func (p *Pipeline) UpdateMask(ms settings.Mask, drawSettings settings.Draw) error {
+// UpdateMask renders the mask for ms. If proxy is true, the mask is rendered
+// from a downscaled frame (see ProxyScale); use FullMask to get the mask at
+// full resolution. It returns ctx.Err() without changing the mask if ctx is
+// cancelled first.
+func (p *Pipeline) UpdateMask(ctx context.Context, ms settings.Mask, drawSettings settings.Draw, proxy bool) error {
+	scale := 1.0
+	if proxy {
+		displayWidth, displayHeight := p.DisplaySize()
+		scale = ProxyScale(p.VideoWidth, p.VideoHeight, displayWidth, displayHeight)
+	}
+	// UpdateMask is the only writer of the mask state, so it can read it
+	// without taking maskLock.
 	maskFrameChanged := ms.Frame != p.MaskSettings.Frame
-	maskFrameMat, err := p.FrameCache.LoadFrame(ms.Frame)
+	maskSettingsChanged := maskFrameChanged || scale != p.MaskScale || p.maskSettingsChanged(ms) || p.Mask == nil
+	if !maskSettingsChanged {
+		return nil
+	}
+	maskFrameMat, err := p.loadPreviewFrame(ms.Frame, scale)
 	if err != nil {
 		return fmt.Errorf("loading frame %d/%s: %v\n",
 			ms.Frame,
-			strconv.FormatFloat(p.VideoCapture.Get(gocv.VideoCaptureFrameCount), 'f', -1, 64),
+			strconv.FormatFloat(p.Capture.Get(gocv.VideoCaptureFrameCount), 'f', -1, 64),
 			err)
 	}
-	if maskFrameChanged {
-		p.MaskSettings.Frame = ms.Frame
+	defer maskFrameMat.Close()
+	if ctx.Err() != nil {
+		return ctx.Err()
 	}
 
-	maskSettingsChanged := maskFrameChanged || p.maskSettingsChanged(ms) || p.Mask == nil
-	var maskMat gocv.Mat
-	defer maskMat.Close()
-	if maskSettingsChanged {
-		maskMat = gocv.NewMat()
-		RenderMask(maskFrameMat, &maskMat, ms)
-		i, err := maskMat.ToImage()
-		if err != nil {
-			return fmt.Errorf("converting mask to image: %v", err)
-		}
-		p.Mask = &i
-		p.MaskSettings = ms
-		p.MaskChanged = true
-	} else {
-		maskMat, err = ImageToMatGray(*p.Mask)
-		if err != nil {
-			return fmt.Errorf("converting p.Mask to mat: %v", err)
+	// Nothing is published until the end, so a cancelled update leaves the
+	// last mask in place.
+	scaled := scaleMaskSettings(ms, scale)
+	hists := p.Histograms
+	if maskFrameChanged || scale != p.MaskScale || p.histogramSettingsChanged(ms) || hists[0] == nil {
+		hists = CropHistograms(maskFrameMat, scaled)
+		if ctx.Err() != nil {
+			return ctx.Err()
 		}
 	}
+	stages, err := renderMaskStages(ctx, maskFrameMat, scaled)
+	if err != nil {
+		return err
+	}
+	maskMat := gocv.NewMat()
+	defer maskMat.Close()
+	gocv.BitwiseAnd(stages.Morphed, stages.Crop, &maskMat)
+	i, err := maskMat.ToImage()
+	if err != nil {
+		stages.Close()
+		return fmt.Errorf("converting mask to image: %v", err)
+	}
+	hash := HashMask(maskMat)
+	if ctx.Err() != nil {
+		stages.Close()
+		return ctx.Err()
+	}
+	p.setMaskStages(stages, scale)
 
+	p.maskLock.Lock()
+	defer p.maskLock.Unlock()
+	p.Mask = &i
 	// TODO: Take layers into account
 	p.MaskWithInput = p.Mask
-
 	// TODO: Take overrides (drawn) into account
 	p.MaskWithOverrides = p.MaskWithInput
+	p.MaskSettings = ms
+	p.MaskScale = scale
+	p.MaskHash = hash
+	p.Histograms = hists
 	return nil
 }
 
-func (p *Pipeline) ApplyMask(frame int, ds settings.Display, rs settings.Render) (image.Image, error) {
-	frameChanged := frame != p.DisplayFrameNumber
-	displayFrameMat, err := p.FrameCache.LoadFrame(frame)
+// maskSnapshot is the mask state that ApplyMask and FullMask read, taken
+// together so that a concurrent UpdateMask can't mix old and new values.
+type maskSnapshot struct {
+	mask     *image.Image
+	settings settings.Mask
+	scale    float64
+	hash     uint64
+}
+
+func (p *Pipeline) snapshotMask() maskSnapshot {
+	p.maskLock.Lock()
+	defer p.maskLock.Unlock()
+	return maskSnapshot{
+		mask:     p.MaskWithOverrides,
+		settings: p.MaskSettings,
+		scale:    p.MaskScale,
+		hash:     p.MaskHash,
+	}
+}
+
+// HasMask returns true once UpdateMask has rendered a mask.
+func (p *Pipeline) HasMask() bool {
+	return p.snapshotMask().mask != nil
+}
+
+// CurrentMaskSettings returns the settings of the current mask.
+func (p *Pipeline) CurrentMaskSettings() settings.Mask {
+	return p.snapshotMask().settings
+}
+
+// ApplyMask returns the preview of frame for the display. The frame is shown
+// at the same scale as the mask, so proxy frames are used if UpdateMask was
+// called with proxy set. It returns ctx.Err() if ctx is cancelled before the
+// preview is rendered.
+func (p *Pipeline) ApplyMask(ctx context.Context, frame int, ds settings.Display, rs settings.Render) (image.Image, error) {
+	m := p.snapshotMask()
+	if m.mask == nil {
+		return nil, fmt.Errorf("mask has not been rendered")
+	}
+	scale := m.scale
+	displayFrameMat, err := p.loadPreviewFrame(frame, scale)
 	if err != nil {
 		return nil, fmt.Errorf("loading frame %d/%s: %v\n",
-			p.DisplayFrameNumber,
-			strconv.FormatFloat(p.VideoCapture.Get(gocv.VideoCaptureFrameCount), 'f', -1, 64),
+			frame,
+			strconv.FormatFloat(p.Capture.Get(gocv.VideoCaptureFrameCount), 'f', -1, 64),
 			err)
 	}
-	if frameChanged {
-		p.DisplayFrameNumber = frame
+	defer displayFrameMat.Close()
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
 	}
 
-	modeChanged := frameChanged || p.DisplaySettings.Mode != ds.Mode || p.MaskChanged || (ds.Mode == display.ViewPreview && rs.InpaintRadius != p.RenderSettings.InpaintRadius)
+	modeChanged := frame != p.DisplayFrameNumber || p.DisplaySettings.Mode != ds.Mode || m.mask != p.displayMask || (ds.Mode == display.ViewPreview && rs.InpaintRadius != p.RenderSettings.InpaintRadius)
 	if modeChanged {
+		rendered, err := p.renderDisplay(ctx, displayFrameMat, frame, m, ds, rs)
+		if err != nil {
+			return nil, err
+		}
+		// Nothing has been published yet, so a cancelled preview leaves the
+		// last one in place.
+		if ctx.Err() != nil {
+			rendered.Close()
+			return nil, ctx.Err()
+		}
 		p.Display.Close()
-		switch ds.Mode {
-		case display.ViewOriginal:
-			p.Display = displayFrameMat.Clone()
-		case display.ViewMask:
-			mask, err := ImageToMatGray(*p.MaskWithOverrides)
-			defer mask.Close()
-			if err != nil {
-				return nil, fmt.Errorf("converting p.MaskWithOverrides to mat: %v", err)
-			}
-			p.Display = gocv.NewMat()
-			gocv.BitwiseAndWithMask(displayFrameMat, displayFrameMat, &p.Display, mask)
-		case display.ViewDraw:
-			// TODO: Display draw layer
-			p.Display = displayFrameMat.Clone()
-		default: // display.ViewPreview
-			mask, err := ImageToMatGray(*p.MaskWithOverrides)
-			defer mask.Close()
-			if err != nil {
-				return nil, fmt.Errorf("converting p.MaskWithOverrides to mat: %v", err)
-			}
-			p.Display = gocv.NewMat()
-			gocv.Inpaint(displayFrameMat, mask, &p.Display, float32(rs.InpaintRadius), gocv.Telea)
+		p.Display = rendered
+		p.DisplayFrameNumber = frame
+		p.displayMask = m.mask
+		if ds.Mode == display.ViewPreview {
 			p.RenderSettings = rs
 		}
-		p.MaskChanged = false
 	}
 
-	zoomChanged := modeChanged || p.zoomChanged(ds)
+	displayWidth, displayHeight := p.DisplaySize()
+	displaySize := image.Pt(displayWidth, displayHeight)
+	zoomChanged := modeChanged || p.zoomChanged(ds) || displaySize != p.ZoomedSize
 	if zoomChanged {
 		p.Zoomed.Close()
-		r := ZoomCropRectangle(ds.Zoom, ds.AnchorX, ds.AnchorY, p.VideoWidth, p.VideoHeight, p.DisplayWidth, p.DisplayHeight)
-		p.Zoomed = gocv.NewMatWithSize(p.DisplayHeight, p.DisplayWidth, gocv.MatTypeCV8UC3)
+		// Zoom and anchor are relative to the source, so convert them to
+		// the scale of the displayed frame.
+		zoom := ds.Zoom / scale
+		anchorX := int(float64(ds.AnchorX) * scale)
+		anchorY := int(float64(ds.AnchorY) * scale)
+		r := ZoomCropRectangle(zoom, anchorX, anchorY, p.Display.Cols(), p.Display.Rows(), displayWidth, displayHeight)
+		p.Zoomed = gocv.NewMatWithSize(displayHeight, displayWidth, gocv.MatTypeCV8UC3)
 		rio := p.Display.Region(r)
 		defer rio.Close()
-		gocv.Resize(rio, &p.Zoomed, image.Point{}, ds.Zoom, ds.Zoom, gocv.InterpolationNearestNeighbor)
+		gocv.Resize(rio, &p.Zoomed, image.Point{}, zoom, zoom, gocv.InterpolationNearestNeighbor)
+		p.ZoomedSize = displaySize
+		p.ZoomRect = image.Rect(
+			int(float64(r.Min.X)/scale),
+			int(float64(r.Min.Y)/scale),
+			int(float64(r.Max.X)/scale),
+			int(float64(r.Max.Y)/scale),
+		)
 	}
 	zoomed, err := p.Zoomed.ToImage()
 	if err != nil {
 		return nil, fmt.Errorf("converting zoomed to image: %v", err)
 	}
 	p.DisplaySettings = ds
+	p.displayLock.Lock()
+	p.viewRect = p.ZoomRect
+	p.viewZoom = ds.Zoom
+	p.viewFrame = frame
+	p.displayLock.Unlock()
 	return zoomed, nil
 }
 
+// setMaskStages replaces the MaskStages that Inspect reads, and closes the
+// old ones.
+func (p *Pipeline) setMaskStages(stages MaskStages, scale float64) {
+	p.stagesLock.Lock()
+	defer p.stagesLock.Unlock()
+	if p.stages != nil {
+		p.stages.Close()
+	}
+	p.stages = &stages
+	p.stagesScale = scale
+}
+
+// renderDisplay returns frameMat as it is shown in ds.Mode, before zooming.
+// The caller must close the result. It returns ctx.Err() if ctx is
+// cancelled while inpainting.
+func (p *Pipeline) renderDisplay(ctx context.Context, frameMat gocv.Mat, frame int, m maskSnapshot, ds settings.Display, rs settings.Render) (gocv.Mat, error) {
+	switch ds.Mode {
+	case display.ViewOriginal:
+		return frameMat.Clone(), nil
+	case display.ViewMask:
+		mask, err := ImageToMatGray(*m.mask)
+		defer mask.Close()
+		if err != nil {
+			return gocv.NewMat(), fmt.Errorf("converting mask to mat: %v", err)
+		}
+		out := gocv.NewMat()
+		gocv.BitwiseAndWithMask(frameMat, frameMat, &out, mask)
+		return out, nil
+	case display.ViewDraw:
+		// TODO: Display draw layer
+		return frameMat.Clone(), nil
+	}
+	// display.ViewPreview
+	// Proxy frames are inpainted with a radius to match their scale.
+	radius := scaleRadius(rs.InpaintRadius, m.scale)
+	key := inpaintKey{frame: frame, scale: m.scale, mask: m.hash, radius: radius}
+	// The cache owns its Mats (and closes them on eviction), so the preview
+	// always gets a copy.
+	if cached, ok := p.inpaintCache.Get(key); ok {
+		return cached.Clone(), nil
+	}
+	mask, err := ImageToMatGray(*m.mask)
+	defer mask.Close()
+	if err != nil {
+		return gocv.NewMat(), fmt.Errorf("converting mask to mat: %v", err)
+	}
+	out := gocv.NewMat()
+	err = inpaintWithRegions(ctx, frameMat, mask, &out, radius, InpaintRegions(mask, radius))
+	if err != nil {
+		out.Close()
+		return gocv.NewMat(), err
+	}
+	p.inpaintCache.Add(key, out.Clone())
+	return out, nil
+}
+
+// SetDisplaySize sets the size of the preview in pixels.
+func (p *Pipeline) SetDisplaySize(width, height int) {
+	p.displayLock.Lock()
+	defer p.displayLock.Unlock()
+	p.displayWidth = width
+	p.displayHeight = height
+}
+
+// DisplaySize returns the size of the preview in pixels.
+func (p *Pipeline) DisplaySize() (width, height int) {
+	p.displayLock.Lock()
+	defer p.displayLock.Unlock()
+	return p.displayWidth, p.displayHeight
+}
+
+// DisplayToVideo converts a position in the preview, given in display pixels
+// from its centre, to a position in the source. The preview image is always
+// centred on ZoomRect.
+func (p *Pipeline) DisplayToVideo(x, y float64) (float64, float64) {
+	cx, cy, zoom := p.viewCentre()
+	return cx + x/zoom, cy + y/zoom
+}
+
+// VideoToDisplay is the inverse of DisplayToVideo.
+func (p *Pipeline) VideoToDisplay(x, y float64) (float64, float64) {
+	cx, cy, zoom := p.viewCentre()
+	return (x - cx) * zoom, (y - cy) * zoom
+}
+
+// viewCentre returns the centre of the preview in video pixels, and its zoom.
+func (p *Pipeline) viewCentre() (cx, cy, zoom float64) {
+	p.displayLock.Lock()
+	defer p.displayLock.Unlock()
+	zoom = p.viewZoom
+	if zoom <= 0 {
+		zoom = 1
+	}
+	cx = float64(p.viewRect.Min.X+p.viewRect.Max.X) / 2
+	cy = float64(p.viewRect.Min.Y+p.viewRect.Max.Y) / 2
+	return cx, cy, zoom
+}
+
+// FrameCount returns the number of frames in the source. The seek index is
+// used if there is one, since it counts every frame rather than relying on
+// the container's estimate.
+func (p *Pipeline) FrameCount() int {
+	if p.Index != nil {
+		return p.Index.FrameCount()
+	}
+	return int(p.Capture.Get(gocv.VideoCaptureFrameCount))
+}
+
+// FrameNumber returns the number that the source uses for frame n. This is
+// the same as n for videos, but image sequences may start at any number.
+func (p *Pipeline) FrameNumber(n int) int {
+	if seq, ok := p.Capture.(*ImageSequence); ok && n >= 0 && n < len(seq.Numbers) {
+		return seq.Numbers[n]
+	}
+	return n
+}
+
 func (p Pipeline) maskSettingsChanged(ms settings.Mask) bool {
 	switch {
-	case ms.HueMin != p.MaskSettings.HueMin,
-		ms.HueMax != p.MaskSettings.HueMax,
-		ms.SatMin != p.MaskSettings.SatMin,
-		ms.SatMax != p.MaskSettings.SatMax,
-		ms.ValMin != p.MaskSettings.ValMin,
-		ms.ValMax != p.MaskSettings.ValMax,
+	case ms.Method != p.MaskSettings.Method,
+		ms.ColorSpace != p.MaskSettings.ColorSpace,
+		ms.Min != p.MaskSettings.Min,
+		ms.Max != p.MaskSettings.Max,
 		ms.Grow != p.MaskSettings.Grow,
+		ms.Shrink != p.MaskSettings.Shrink,
+		ms.Open != p.MaskSettings.Open,
+		ms.Close != p.MaskSettings.Close,
+		ms.Kernel != p.MaskSettings.Kernel,
+		ms.MinArea != p.MaskSettings.MinArea,
+		ms.MaxArea != p.MaskSettings.MaxArea,
+		ms.MinAspect != p.MaskSettings.MinAspect,
+		ms.MaxAspect != p.MaskSettings.MaxAspect,
+		ms.MinSolidity != p.MaskSettings.MinSolidity,
+		ms.MaxSolidity != p.MaskSettings.MaxSolidity,
+		ms.DeltaE != p.MaskSettings.DeltaE,
+		!slices.Equal(ms.ReferenceColors, p.MaskSettings.ReferenceColors),
 		ms.CropLeft != p.MaskSettings.CropLeft,
 		ms.CropTop != p.MaskSettings.CropTop,
 		ms.CropRight != p.MaskSettings.CropRight,
-		ms.CropBottom != p.MaskSettings.CropBottom:
+		ms.CropBottom != p.MaskSettings.CropBottom,
+		!reflect.DeepEqual(ms.Crops, p.MaskSettings.Crops):
 		return true
 	}
 	return false
@@ -0,0 +1,171 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"image"
+	"testing"
+
+	"gocv.io/x/gocv"
+
+	"github.com/sandalwoodbox/go-cleancredits/cleancredits/display"
+	"github.com/sandalwoodbox/go-cleancredits/cleancredits/mask"
+	"github.com/sandalwoodbox/go-cleancredits/cleancredits/settings"
+)
+
+// newTestPipeline returns a Pipeline for the horses video, with a 640x360
+// display.
+func newTestPipeline(t *testing.T) *Pipeline {
+	t.Helper()
+	src := settings.Source{Path: "testdata/horses-720p.mp4", Kind: SourceVideo}
+	vc, err := OpenCapture(src)
+	if err != nil {
+		t.Fatalf("Error opening video: %v", err)
+	}
+	t.Cleanup(func() { vc.Close() })
+	index, err := IndexSource(src)
+	if err != nil {
+		t.Fatalf("Error indexing video: %v", err)
+	}
+	p, err := NewPipeline(src, vc, index, DefaultCacheOptions, 640, 360)
+	if err != nil {
+		t.Fatalf("Error creating pipeline: %v", err)
+	}
+	return p
+}
+
+// testMaskSettings selects the bright parts of frame, across the whole of
+// the 1280x720 video.
+func testMaskSettings(frame int) settings.Mask {
+	return settings.Mask{
+		Frame:      frame,
+		ColorSpace: mask.ColorSpaceHSV,
+		Min:        [3]int{0, 0, 200},
+		Max:        [3]int{mask.HueMax, mask.SatMax, mask.ValMax},
+		CropRight:  1280,
+		CropBottom: 720,
+	}
+}
+
+func TestPipeline_cancelled(t *testing.T) {
+	p := newTestPipeline(t)
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	ms := testMaskSettings(0)
+
+	err := p.UpdateMask(cancelled, ms, settings.Draw{}, false)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("UpdateMask with a cancelled context returned %v", err)
+	}
+	if p.HasMask() {
+		t.Fatal("cancelled UpdateMask published a mask")
+	}
+
+	err = p.UpdateMask(context.Background(), ms, settings.Draw{}, false)
+	if err != nil {
+		t.Fatalf("UpdateMask returned error: %v", err)
+	}
+	hash := p.MaskHash
+	changed := ms
+	changed.Min[2] = 100
+	err = p.UpdateMask(cancelled, changed, settings.Draw{}, false)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("UpdateMask with a cancelled context returned %v", err)
+	}
+	if p.CurrentMaskSettings().Min != ms.Min || p.MaskHash != hash {
+		t.Error("cancelled UpdateMask replaced the mask")
+	}
+
+	ds := settings.Display{Mode: display.ViewPreview, Zoom: 1}
+	rs := settings.Render{InpaintRadius: 3}
+	_, err = p.ApplyMask(context.Background(), 0, ds, rs)
+	if err != nil {
+		t.Fatalf("ApplyMask returned error: %v", err)
+	}
+	_, err = p.ApplyMask(cancelled, 1, ds, rs)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("ApplyMask with a cancelled context returned %v", err)
+	}
+	if p.DisplayFrameNumber != 0 {
+		t.Errorf("cancelled ApplyMask changed the displayed frame to %d", p.DisplayFrameNumber)
+	}
+}
+
+func TestApplyMask_inpaintCache(t *testing.T) {
+	p := newTestPipeline(t)
+	ctx := context.Background()
+	ms := testMaskSettings(0)
+	update := func(ms settings.Mask, proxy bool) {
+		t.Helper()
+		err := p.UpdateMask(ctx, ms, settings.Draw{}, proxy)
+		if err != nil {
+			t.Fatalf("UpdateMask returned error: %v", err)
+		}
+	}
+	// preview shows frame n with the mask inpainted, after showing the
+	// original frame so that the preview is always rendered again.
+	preview := func(n, radius int) image.Image {
+		t.Helper()
+		rs := settings.Render{InpaintRadius: radius}
+		_, err := p.ApplyMask(ctx, n, settings.Display{Mode: display.ViewOriginal, Zoom: 1}, rs)
+		if err != nil {
+			t.Fatalf("ApplyMask returned error: %v", err)
+		}
+		img, err := p.ApplyMask(ctx, n, settings.Display{Mode: display.ViewPreview, Zoom: 1}, rs)
+		if err != nil {
+			t.Fatalf("ApplyMask returned error: %v", err)
+		}
+		return img
+	}
+	// The cached preview is replaced with solid magenta, so that cache hits
+	// can be told apart from inpainting again.
+	isMarker := func(img image.Image) bool {
+		r, g, b, _ := img.At(0, 0).RGBA()
+		return r == 0xffff && g == 0 && b == 0xffff
+	}
+
+	update(ms, false)
+	if isMarker(preview(0, 3)) {
+		t.Fatal("the frame is already magenta")
+	}
+	base := inpaintKey{frame: 0, scale: 1, mask: p.MaskHash, radius: 3}
+	if !p.inpaintCache.Contains(base) {
+		t.Fatal("the preview wasn't cached")
+	}
+	p.inpaintCache.Add(base, gocv.NewMatWithSizeFromScalar(gocv.NewScalar(255, 0, 255, 0), p.VideoHeight, p.VideoWidth, gocv.MatTypeCV8UC3))
+	if !isMarker(preview(0, 3)) {
+		t.Fatal("the same frame, mask, scale and radius missed the cache")
+	}
+
+	changed := ms
+	changed.Min[2] = 100
+	cases := []struct {
+		name          string
+		frame, radius int
+		ms            settings.Mask
+		proxy         bool
+	}{
+		{name: "frame", frame: 1, radius: 3, ms: ms},
+		{name: "radius", frame: 0, radius: 4, ms: ms},
+		{name: "mask", frame: 0, radius: 3, ms: changed},
+		{name: "proxy scale", frame: 0, radius: 3, ms: ms, proxy: true},
+	}
+	for _, tc := range cases {
+		update(tc.ms, tc.proxy)
+		if tc.proxy && p.MaskScale == 1 {
+			t.Fatal("the proxy mask is at full resolution")
+		}
+		if isMarker(preview(tc.frame, tc.radius)) {
+			t.Errorf("changing the %s hit the cache", tc.name)
+		}
+		key := inpaintKey{frame: tc.frame, scale: p.MaskScale, mask: p.MaskHash, radius: scaleRadius(tc.radius, p.MaskScale)}
+		if key == base || !p.inpaintCache.Contains(key) {
+			t.Errorf("changing the %s didn't inpaint and cache a new preview", tc.name)
+		}
+		// Changing back hits the cache again.
+		update(ms, false)
+		if !isMarker(preview(0, 3)) {
+			t.Errorf("changing the %s back missed the cache", tc.name)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package pipeline
+
+import (
+	"fmt"
+	"image"
+	"math"
+
+	"gocv.io/x/gocv"
+
+	"github.com/sandalwoodbox/go-cleancredits/cleancredits/settings"
+)
+
+// ProxyCacheFrames is how many downscaled frames are kept for the preview.
+const ProxyCacheFrames = 32
+
+type proxyKey struct {
+	frame int
+	scale float64
+}
+
+// ProxyScale returns the scale used for proxy frames: the largest size that
+// fits in the display without zooming. Frames are never scaled up.
+func ProxyScale(videoWidth, videoHeight, displayWidth, displayHeight int) float64 {
+	if displayWidth <= 0 || displayHeight <= 0 || videoWidth <= 0 || videoHeight <= 0 {
+		return 1
+	}
+	return math.Min(1, math.Min(
+		float64(displayWidth)/float64(videoWidth),
+		float64(displayHeight)/float64(videoHeight),
+	))
+}
+
+// scaleMaskSettings returns ms with its pixel measurements scaled to match a
+// frame that has been resized by scale.
+func scaleMaskSettings(ms settings.Mask, scale float64) settings.Mask {
+	if scale == 1 {
+		return ms
+	}
+	px := func(n int) int {
+		return int(math.Round(float64(n) * scale))
+	}
+	for _, size := range []*int{&ms.Grow, &ms.Shrink, &ms.Open, &ms.Close} {
+		if *size > 0 {
+			*size = max(px(*size), 1)
+		}
+	}
+	// Areas scale twice.
+	for _, area := range []*int{&ms.MinArea, &ms.MaxArea} {
+		if *area > 0 {
+			*area = max(int(math.Round(float64(*area)*scale*scale)), 1)
+		}
+	}
+	ms.CropLeft = px(ms.CropLeft)
+	ms.CropTop = px(ms.CropTop)
+	ms.CropRight = px(ms.CropRight)
+	ms.CropBottom = px(ms.CropBottom)
+	crops := make([]settings.Crop, len(ms.Crops))
+	for i, c := range ms.Crops {
+		crops[i] = settings.Crop{
+			Shape:  c.Shape,
+			Left:   px(c.Left),
+			Top:    px(c.Top),
+			Right:  px(c.Right),
+			Bottom: px(c.Bottom),
+		}
+		for _, pt := range c.Points {
+			crops[i].Points = append(crops[i].Points, image.Pt(px(pt.X), px(pt.Y)))
+		}
+	}
+	ms.Crops = crops
+	return ms
+}
+
+// scaleRadius returns an inpaint radius, in source pixels, scaled to match a
+// frame that has been resized by scale. It is at least 1.
+func scaleRadius(radius int, scale float64) int {
+	if scale == 1 {
+		return radius
+	}
+	return max(int(math.Round(float64(radius)*scale)), 1)
+}
+
+// loadPreviewFrame returns a copy of frame n resized by scale, which the
+// caller must close. Resized frames are cached separately from the full
+// resolution frames.
+func (p *Pipeline) loadPreviewFrame(n int, scale float64) (gocv.Mat, error) {
+	if scale == 1 {
+		return p.FrameCache.LoadFrame(n)
+	}
+	key := proxyKey{frame: n, scale: scale}
+	// Another goroutine's Add can evict and close a cached Mat at any time,
+	// so it is only copied while proxyLock is held.
+	p.proxyLock.Lock()
+	if cached, ok := p.proxyCache.Get(key); ok {
+		mat := cached.Clone()
+		p.proxyLock.Unlock()
+		return mat, nil
+	}
+	p.proxyLock.Unlock()
+	full, err := p.FrameCache.LoadFrame(n)
+	if err != nil {
+		return gocv.NewMat(), err
+	}
+	defer full.Close()
+	mat := gocv.NewMat()
+	gocv.Resize(full, &mat, image.Point{}, scale, scale, gocv.InterpolationArea)
+	p.proxyLock.Lock()
+	p.proxyCache.Add(key, mat.Clone())
+	p.proxyLock.Unlock()
+	return mat, nil
+}
+
+// FullMask returns the current mask at the source's full resolution. If the
+// preview is using proxy frames, the mask is rendered again from the full
+// resolution frame. The caller must close the returned Mat.
+func (p *Pipeline) FullMask() (gocv.Mat, error) {
+	m := p.snapshotMask()
+	if m.mask == nil {
+		return gocv.NewMat(), fmt.Errorf("mask has not been rendered")
+	}
+	if m.scale == 1 {
+		mask, err := ImageToMatGray(*m.mask)
+		if err != nil {
+			mask.Close()
+			return gocv.NewMat(), fmt.Errorf("converting MaskWithOverrides to mat: %v", err)
+		}
+		return mask, nil
+	}
+	frame, err := p.FrameCache.LoadFrame(m.settings.Frame)
+	if err != nil {
+		return gocv.NewMat(), fmt.Errorf("loading frame %d: %v", m.settings.Frame, err)
+	}
+	defer frame.Close()
+	mask := gocv.NewMat()
+	// TODO: Take layers and overrides into account, as UpdateMask does.
+	RenderMask(frame, &mask, m.settings)
+	return mask, nil
+}
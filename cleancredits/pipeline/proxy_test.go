@@ -0,0 +1,23 @@
+package pipeline
+
+import "testing"
+
+func TestScaleRadius(t *testing.T) {
+	cases := []struct {
+		radius int
+		scale  float64
+		want   int
+	}{
+		{radius: 3, scale: 1, want: 3},
+		{radius: 0, scale: 1, want: 0},
+		{radius: 10, scale: .5, want: 5},
+		{radius: 3, scale: .5, want: 2},
+		{radius: 3, scale: .1, want: 1},
+		{radius: 0, scale: .5, want: 1},
+	}
+	for _, tc := range cases {
+		if got := scaleRadius(tc.radius, tc.scale); got != tc.want {
+			t.Errorf("scaleRadius(%d, %v) = %d, want %d", tc.radius, tc.scale, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,210 @@
+package pipeline
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gocv.io/x/gocv"
+)
+
+// DefaultSequenceFPS is the frame rate used for image sequences, since image
+// files don't carry any timing information.
+const DefaultSequenceFPS = 24
+
+// ImageExtensions are the file extensions that can be opened as image
+// sequences or still images.
+var ImageExtensions = []string{".png", ".tif", ".tiff", ".dpx", ".jpg", ".jpeg", ".bmp"}
+
+// frameNumberRe splits a file name into the text before the last run of
+// digits, the digits themselves, and the (non-numeric) remainder.
+var frameNumberRe = regexp.MustCompile(`^(.*?)(\d+)(\D*)$`)
+
+// ImageSequence is a Capture that reads a set of numbered image files (for
+// example credits.0001.dpx, credits.0002.dpx, ...) as consecutive frames.
+// Frame n is always Paths[n], regardless of where the file numbering starts.
+type ImageSequence struct {
+	Paths   []string
+	Numbers []int
+	FPS     float64
+
+	pos    int
+	width  int
+	height int
+}
+
+// NewImageSequence finds all of the files in the same directory as path that
+// only differ from it by their frame number, and returns them as an
+// ImageSequence ordered by frame number.
+func NewImageSequence(path string) (*ImageSequence, error) {
+	dir, name := filepath.Split(path)
+	m := frameNumberRe.FindStringSubmatch(name)
+	if m == nil {
+		return nil, fmt.Errorf("%s does not contain a frame number", name)
+	}
+	prefix, suffix := m[1], m[3]
+	if dir == "" {
+		dir = "."
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %v", dir, err)
+	}
+
+	type frame struct {
+		number int
+		path   string
+	}
+	var frames []frame
+	for _, e := range entries {
+		n := e.Name()
+		if e.IsDir() || len(n) <= len(prefix)+len(suffix) || !strings.HasPrefix(n, prefix) || !strings.HasSuffix(n, suffix) {
+			continue
+		}
+		digits := n[len(prefix) : len(n)-len(suffix)]
+		if strings.Trim(digits, "0123456789") != "" {
+			continue
+		}
+		number, err := strconv.Atoi(digits)
+		if err != nil {
+			continue
+		}
+		frames = append(frames, frame{number: number, path: filepath.Join(dir, n)})
+	}
+	slices.SortFunc(frames, func(a, b frame) int { return a.number - b.number })
+
+	s := &ImageSequence{FPS: DefaultSequenceFPS}
+	for _, f := range frames {
+		s.Paths = append(s.Paths, f.path)
+		s.Numbers = append(s.Numbers, f.number)
+	}
+	if err := s.loadDimensions(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// NewImageFile returns a single-frame ImageSequence for a still image.
+func NewImageFile(path string) (*ImageSequence, error) {
+	s := &ImageSequence{
+		Paths:   []string{path},
+		Numbers: []int{0},
+		FPS:     DefaultSequenceFPS,
+	}
+	if err := s.loadDimensions(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *ImageSequence) loadDimensions() error {
+	if len(s.Paths) == 0 {
+		return fmt.Errorf("image sequence is empty")
+	}
+	first, err := readImage(s.Paths[0])
+	if err != nil {
+		return fmt.Errorf("loading first frame: %v", err)
+	}
+	defer first.Close()
+	s.width = first.Cols()
+	s.height = first.Rows()
+	return nil
+}
+
+func (s *ImageSequence) Get(prop gocv.VideoCaptureProperties) float64 {
+	switch prop {
+	case gocv.VideoCaptureFrameWidth:
+		return float64(s.width)
+	case gocv.VideoCaptureFrameHeight:
+		return float64(s.height)
+	case gocv.VideoCaptureFrameCount:
+		return float64(len(s.Paths))
+	case gocv.VideoCaptureFPS:
+		return s.FPS
+	case gocv.VideoCapturePosFrames:
+		return float64(s.pos)
+	case gocv.VideoCapturePosMsec:
+		return float64(s.pos) * 1000 / s.FPS
+	}
+	return 0
+}
+
+func (s *ImageSequence) Set(prop gocv.VideoCaptureProperties, param float64) {
+	switch prop {
+	case gocv.VideoCapturePosFrames:
+		s.pos = int(param)
+	case gocv.VideoCapturePosMsec:
+		s.pos = int(math.Round(param * s.FPS / 1000))
+	}
+}
+
+func (s *ImageSequence) Read(m *gocv.Mat) bool {
+	if s.pos < 0 || s.pos >= len(s.Paths) {
+		return false
+	}
+	img, err := readImage(s.Paths[s.pos])
+	if err != nil {
+		fmt.Println("Error reading image sequence frame: ", err)
+		return false
+	}
+	defer img.Close()
+	img.CopyTo(m)
+	s.pos++
+	return true
+}
+
+func (s *ImageSequence) Grab(skip int) error {
+	s.pos += skip
+	return nil
+}
+
+// CodecString returns an empty string; image sequences aren't encoded with a
+// video codec.
+func (s *ImageSequence) CodecString() string {
+	return ""
+}
+
+func (s *ImageSequence) Close() error {
+	return nil
+}
+
+// readImage loads an image file as an 8-bit BGR Mat. Formats that OpenCV
+// can't decode by itself (such as DPX) are read through the FFmpeg backend.
+func readImage(path string) (gocv.Mat, error) {
+	mat := gocv.IMRead(path, gocv.IMReadColor)
+	if !mat.Empty() {
+		return mat, nil
+	}
+	mat.Close()
+	vc, err := gocv.VideoCaptureFileWithAPI(path, gocv.VideoCaptureFFmpeg)
+	if err != nil {
+		vc.Close()
+		return gocv.NewMat(), fmt.Errorf("reading %s: %v", path, err)
+	}
+	defer vc.Close()
+	mat = gocv.NewMat()
+	if !vc.Read(&mat) || mat.Empty() {
+		mat.Close()
+		return gocv.NewMat(), fmt.Errorf("reading %s: unsupported image format", path)
+	}
+	return mat, nil
+}
+
+// SequencePattern returns a printf-style pattern for numbering the frames of
+// an image sequence written to path. If the file name already ends in a
+// number, its width is kept (out_0001.png becomes out_%04d.png); otherwise a
+// six digit frame number is appended to the name.
+func SequencePattern(path string) string {
+	dir, name := filepath.Split(path)
+	name = strings.ReplaceAll(name, "%", "%%")
+	if m := frameNumberRe.FindStringSubmatch(name); m != nil {
+		return filepath.Join(dir, fmt.Sprintf("%s%%0%dd%s", m[1], len(m[2]), m[3]))
+	}
+	ext := filepath.Ext(name)
+	return filepath.Join(dir, strings.TrimSuffix(name, ext)+"_%06d"+ext)
+}
@@ -0,0 +1,178 @@
+package pipeline
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"gocv.io/x/gocv"
+)
+
+type spillEntry struct {
+	rows, cols int
+	matType    gocv.MatType
+	size       int64
+}
+
+// spillCache keeps decoded frames in raw files on disk, so that frames
+// evicted from memory can be loaded again without decoding them. Only frames
+// in the active range are kept, up to budget bytes. locker only guards the
+// bookkeeping, so files are read and written without blocking other calls.
+type spillCache struct {
+	locker *sync.Mutex
+	budget int64
+	// used includes frames that are still being written.
+	used int64
+	// start and end are the (inclusive) active range.
+	start, end int
+	// dir is created the first time a frame is written.
+	dir     string
+	frames  map[int]spillEntry
+	writing map[int]bool
+	closed  bool
+}
+
+func newSpillCache(budget int64) *spillCache {
+	return &spillCache{
+		locker:  &sync.Mutex{},
+		budget:  budget,
+		end:     -1,
+		frames:  map[int]spillEntry{},
+		writing: map[int]bool{},
+	}
+}
+
+func (s *spillCache) path(n int) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%08d.raw", n))
+}
+
+// Put writes frame n to disk if it is in the active range and fits in the
+// budget.
+func (s *spillCache) Put(n int, mat gocv.Mat) error {
+	if mat.Empty() {
+		return nil
+	}
+	e := spillEntry{rows: mat.Rows(), cols: mat.Cols(), matType: mat.Type()}
+	e.size = int64(e.rows) * int64(e.cols) * int64(mat.ElemSize())
+	path, ok, err := s.reserve(n, e.size)
+	if !ok || err != nil {
+		return err
+	}
+	err = os.WriteFile(path, mat.ToBytes(), 0o600)
+
+	s.locker.Lock()
+	defer s.locker.Unlock()
+	delete(s.writing, n)
+	switch {
+	case s.closed:
+		// Close has already reset the budget.
+		os.Remove(path)
+		return nil
+	case err != nil:
+		os.Remove(path)
+		s.used -= e.size
+		return fmt.Errorf("writing frame %d: %v", n, err)
+	case n < s.start || n > s.end:
+		// The range changed while the frame was being written.
+		os.Remove(path)
+		s.used -= e.size
+		return nil
+	}
+	s.frames[n] = e
+	return nil
+}
+
+// reserve sets aside size bytes of the budget for writing frame n to path.
+// ok is false if the frame shouldn't be written.
+func (s *spillCache) reserve(n int, size int64) (path string, ok bool, err error) {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+	if s.closed || n < s.start || n > s.end || s.writing[n] {
+		return "", false, nil
+	}
+	if _, ok := s.frames[n]; ok {
+		return "", false, nil
+	}
+	if s.used+size > s.budget {
+		return "", false, nil
+	}
+	if s.dir == "" {
+		dir, err := os.MkdirTemp("", "cleancredits-frames-")
+		if err != nil {
+			return "", false, fmt.Errorf("creating spill directory: %v", err)
+		}
+		s.dir = dir
+	}
+	s.writing[n] = true
+	s.used += size
+	return s.path(n), true, nil
+}
+
+// Get loads frame n from disk. ok is false if the frame hasn't been spilled.
+func (s *spillCache) Get(n int) (mat gocv.Mat, ok bool, err error) {
+	s.locker.Lock()
+	e, ok := s.frames[n]
+	path := s.path(n)
+	s.locker.Unlock()
+	if !ok {
+		return gocv.NewMat(), false, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		s.locker.Lock()
+		s.remove(n)
+		s.locker.Unlock()
+		return gocv.NewMat(), false, fmt.Errorf("reading frame %d: %v", n, err)
+	}
+	raw, err := gocv.NewMatFromBytes(e.rows, e.cols, e.matType, data)
+	if err != nil {
+		s.locker.Lock()
+		s.remove(n)
+		s.locker.Unlock()
+		return gocv.NewMat(), false, fmt.Errorf("loading frame %d: %v", n, err)
+	}
+	// raw refers to data, so copy it into memory owned by OpenCV.
+	defer raw.Close()
+	return raw.Clone(), true, nil
+}
+
+// SetRange changes the active range, removing frames that fall outside it.
+func (s *spillCache) SetRange(start, end int) {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+	s.start = start
+	s.end = end
+	for n := range s.frames {
+		if n < start || n > end {
+			s.remove(n)
+		}
+	}
+}
+
+// remove deletes frame n. The caller must hold s.locker.
+func (s *spillCache) remove(n int) {
+	e, ok := s.frames[n]
+	if !ok {
+		return
+	}
+	os.Remove(s.path(n))
+	s.used -= e.size
+	delete(s.frames, n)
+}
+
+// Close deletes all spilled frames. Frames that are put afterwards are not
+// written.
+func (s *spillCache) Close() error {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+	s.closed = true
+	s.frames = map[int]spillEntry{}
+	s.used = 0
+	if s.dir == "" {
+		return nil
+	}
+	dir := s.dir
+	s.dir = ""
+	return os.RemoveAll(dir)
+}
@@ -0,0 +1,57 @@
+package pipeline
+
+import (
+	"fmt"
+	"io"
+
+	"gocv.io/x/gocv"
+
+	"github.com/sandalwoodbox/go-cleancredits/cleancredits/settings"
+	"github.com/sandalwoodbox/go-cleancredits/cleancredits/y4m"
+)
+
+// StreamY4M reads YUV4MPEG2 frames from r, inpaints each one using the
+// current mask and writes the results to w as YUV4MPEG2. UpdateMask must
+// have been called first.
+func (p *Pipeline) StreamY4M(r io.Reader, w io.Writer, rs settings.Render) error {
+	mask, err := p.FullMask()
+	if err != nil {
+		mask.Close()
+		return err
+	}
+	defer mask.Close()
+
+	in, err := y4m.NewReader(r)
+	if err != nil {
+		return fmt.Errorf("opening input stream: %v", err)
+	}
+	if in.Header.Width != mask.Cols() || in.Header.Height != mask.Rows() {
+		return fmt.Errorf("input stream is %dx%d but the mask is %dx%d",
+			in.Header.Width, in.Header.Height, mask.Cols(), mask.Rows())
+	}
+	out, err := y4m.NewWriter(w, in.Header)
+	if err != nil {
+		return fmt.Errorf("opening output stream: %v", err)
+	}
+
+	regions := InpaintRegions(mask, rs.InpaintRadius)
+	frame := gocv.NewMat()
+	defer frame.Close()
+	cleaned := gocv.NewMat()
+	defer cleaned.Close()
+	for i := 0; ; i++ {
+		err = in.ReadFrame(&frame)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("reading frame %d: %v", i, err)
+		}
+		InpaintWithRegions(frame, mask, &cleaned, rs.InpaintRadius, regions)
+		err = out.WriteFrame(cleaned)
+		if err != nil {
+			return fmt.Errorf("writing frame %d: %v", i, err)
+		}
+	}
+	return out.Flush()
+}
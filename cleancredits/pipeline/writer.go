@@ -0,0 +1,115 @@
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"gocv.io/x/gocv"
+)
+
+// OutputImageExtensions are the file extensions that Render writes as
+// numbered image sequences rather than video files.
+var OutputImageExtensions = []string{".png", ".tif", ".tiff", ".jpg", ".jpeg"}
+
+// FrameWriter writes rendered frames to an output target. n is the number
+// of the frame being written.
+type FrameWriter interface {
+	Write(n int, mat gocv.Mat) error
+	Close() error
+}
+
+// NewFrameWriter returns a FrameWriter for path. Paths with an image
+// extension are written as numbered image sequences, or as a single image
+// if frameCount is 1. Anything else is encoded as a video file with the given
+// codec and frame rate.
+func NewFrameWriter(path, codec string, fps float64, width, height, frameCount int) (FrameWriter, error) {
+	if IsImagePath(path, OutputImageExtensions) {
+		if frameCount == 1 {
+			return ImageWriter{Path: path}, nil
+		}
+		// The save dialog creates an empty file at path, which would be
+		// mistaken for a frame when the sequence is opened again.
+		err := removeEmptyFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("removing placeholder: %v", err)
+		}
+		return ImageSequenceWriter{Pattern: SequencePattern(path)}, nil
+	}
+	vw, err := gocv.VideoWriterFile(path, codec, fps, width, height, true)
+	if err != nil {
+		return nil, fmt.Errorf("opening video writer: %v", err)
+	}
+	return videoWriter{vw: vw}, nil
+}
+
+// IsImagePath returns true if path has one of the given (lower case) image
+// extensions.
+func IsImagePath(path string, extensions []string) bool {
+	return slices.Contains(extensions, strings.ToLower(filepath.Ext(path)))
+}
+
+// removeEmptyFile removes the file at path if it exists and is empty.
+func removeEmptyFile(path string) error {
+	info, err := os.Stat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.IsDir() || info.Size() > 0 {
+		return nil
+	}
+	return os.Remove(path)
+}
+
+type videoWriter struct {
+	vw *gocv.VideoWriter
+}
+
+func (w videoWriter) Write(n int, mat gocv.Mat) error {
+	return w.vw.Write(mat)
+}
+
+func (w videoWriter) Close() error {
+	return w.vw.Close()
+}
+
+// ImageSequenceWriter writes each frame to its own image file, named by
+// formatting Pattern with the frame number.
+type ImageSequenceWriter struct {
+	Pattern string
+}
+
+func (w ImageSequenceWriter) Write(n int, mat gocv.Mat) error {
+	path := fmt.Sprintf(w.Pattern, n)
+	if !gocv.IMWrite(path, mat) {
+		return fmt.Errorf("writing %s", path)
+	}
+	return nil
+}
+
+func (w ImageSequenceWriter) Close() error {
+	return nil
+}
+
+// ImageWriter writes a single frame to an image file at Path.
+type ImageWriter struct {
+	Path string
+}
+
+func (w ImageWriter) Write(n int, mat gocv.Mat) error {
+	if !gocv.IMWrite(w.Path, mat) {
+		return fmt.Errorf("writing %s", w.Path)
+	}
+	return nil
+}
+
+func (w ImageWriter) Close() error {
+	return nil
+}
@@ -0,0 +1,104 @@
+package pipeline
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gocv.io/x/gocv"
+)
+
+func TestNewFrameWriter_sequence(t *testing.T) {
+	cases := []struct {
+		name string
+		// file is the name chosen in the save dialog, which creates it.
+		file    string
+		numbers []int
+		want    []string
+	}{
+		{
+			name:    "unnumbered",
+			file:    "out.png",
+			numbers: []int{0, 1, 2},
+			want:    []string{"out_000000.png", "out_000001.png", "out_000002.png"},
+		},
+		{
+			name:    "numbered",
+			file:    "out_0001.png",
+			numbers: []int{5, 6, 7},
+			want:    []string{"out_0005.png", "out_0006.png", "out_0007.png"},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, tc.file)
+			err := os.WriteFile(path, nil, 0o644)
+			if err != nil {
+				t.Fatalf("creating placeholder: %v", err)
+			}
+
+			frame := gocv.NewMatWithSizeFromScalar(gocv.NewScalar(10, 20, 30, 0), 6, 8, gocv.MatTypeCV8UC3)
+			defer frame.Close()
+			w, err := NewFrameWriter(path, "", DefaultSequenceFPS, frame.Cols(), frame.Rows(), len(tc.numbers))
+			if err != nil {
+				t.Fatalf("NewFrameWriter returned error: %v", err)
+			}
+			for _, n := range tc.numbers {
+				err := w.Write(n, frame)
+				if err != nil {
+					t.Fatalf("writing frame %d: %v", n, err)
+				}
+			}
+			err = w.Close()
+			if err != nil {
+				t.Fatalf("closing writer: %v", err)
+			}
+
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				t.Fatalf("reading output directory: %v", err)
+			}
+			var got []string
+			for _, e := range entries {
+				got = append(got, e.Name())
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tc.want) {
+				t.Errorf("wrote %v, want %v", got, tc.want)
+			}
+
+			seq, err := NewImageSequence(filepath.Join(dir, tc.want[0]))
+			if err != nil {
+				t.Fatalf("reopening sequence: %v", err)
+			}
+			if len(seq.Paths) != len(tc.numbers) {
+				t.Errorf("reopened %d frames, want %d", len(seq.Paths), len(tc.numbers))
+			}
+			if seq.Numbers[0] != tc.numbers[0] {
+				t.Errorf("reopened sequence starts at %d, want %d", seq.Numbers[0], tc.numbers[0])
+			}
+			w2 := int(seq.Get(gocv.VideoCaptureFrameWidth))
+			h2 := int(seq.Get(gocv.VideoCaptureFrameHeight))
+			if w2 != frame.Cols() || h2 != frame.Rows() {
+				t.Errorf("reopened sequence is %dx%d, want %dx%d", w2, h2, frame.Cols(), frame.Rows())
+			}
+		})
+	}
+}
+
+func TestNewFrameWriter_keepsImages(t *testing.T) {
+	// Only empty placeholders are removed.
+	path := filepath.Join(t.TempDir(), "out.png")
+	err := os.WriteFile(path, []byte("not empty"), 0o644)
+	if err != nil {
+		t.Fatalf("creating file: %v", err)
+	}
+	_, err = NewFrameWriter(path, "", DefaultSequenceFPS, 8, 6, 3)
+	if err != nil {
+		t.Fatalf("NewFrameWriter returned error: %v", err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("NewFrameWriter removed a file that wasn't empty: %v", err)
+	}
+}
@@ -0,0 +1,66 @@
+package preferences
+
+import (
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/data/binding"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/layout"
+	"fyne.io/fyne/v2/widget"
+
+	"github.com/sandalwoodbox/go-cleancredits/cleancredits/pipeline"
+	ccWidget "github.com/sandalwoodbox/go-cleancredits/cleancredits/widget"
+)
+
+const (
+	CacheMemoryKey = "cacheMemoryMB"
+	CacheDiskKey   = "cacheDiskMB"
+
+	DefaultCacheMemoryMB = pipeline.DefaultCacheBytes >> 20
+	MaxCacheMemoryMB     = 1 << 16
+	MaxCacheDiskMB       = 1 << 20
+)
+
+// Form edits the preferences stored in fyne's preferences store.
+type Form struct {
+	Container *fyne.Container
+
+	CacheMemoryMB binding.Int
+	CacheDiskMB   binding.Int
+}
+
+func NewForm(p fyne.Preferences) Form {
+	f := Form{
+		CacheMemoryMB: binding.BindPreferenceInt(CacheMemoryKey, p),
+		CacheDiskMB:   binding.BindPreferenceInt(CacheDiskKey, p),
+	}
+	f.Container = container.New(
+		layout.NewGridLayout(2),
+		widget.NewLabel("Frame cache memory (MB)"), ccWidget.NewIntEntryWithData(1, MaxCacheMemoryMB, f.CacheMemoryMB),
+		// Frames in the render range are kept on disk after being evicted from memory.
+		widget.NewLabel("Frame cache disk (MB, 0 = off)"), ccWidget.NewIntEntryWithData(0, MaxCacheDiskMB, f.CacheDiskMB),
+	)
+	return f
+}
+
+// SetDefaults stores default values for any preferences that haven't been
+// set yet, so that they show up in the form.
+func SetDefaults(p fyne.Preferences) {
+	p.SetInt(CacheMemoryKey, p.IntWithFallback(CacheMemoryKey, DefaultCacheMemoryMB))
+	p.SetInt(CacheDiskKey, p.IntWithFallback(CacheDiskKey, 0))
+}
+
+// CacheOptions returns the frame cache options from p.
+func CacheOptions(p fyne.Preferences) pipeline.CacheOptions {
+	return pipeline.CacheOptions{
+		MemoryBytes: int64(p.IntWithFallback(CacheMemoryKey, DefaultCacheMemoryMB)) << 20,
+		DiskBytes:   int64(p.IntWithFallback(CacheDiskKey, 0)) << 20,
+	}
+}
+
+// ShowDialog shows the preferences form. Changes are saved as they are made
+// and apply to the next file opened.
+func ShowDialog(p fyne.Preferences, w fyne.Window) {
+	f := NewForm(p)
+	dialog.ShowCustom("Preferences", "Close", f.Container, w)
+}
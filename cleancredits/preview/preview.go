@@ -3,36 +3,191 @@ package preview
 import (
 	"image"
 	"image/color"
+	"math"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/canvas"
-	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/driver/desktop"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
 )
 
+const (
+	DefaultWidth  = 720
+	DefaultHeight = 480
+	MinWidth      = 240
+	MinHeight     = 160
+)
+
+// Preview shows the rendered frame, filling as much space as its container
+// gives it.
 type Preview struct {
-	Image     *canvas.Image
-	Container *fyne.Container
-	Width     int
-	Height    int
+	widget.BaseWidget
+	Image *canvas.Image
+	// Width and Height are the current size of the preview in pixels.
+	Width  int
+	Height int
+	// OnResized is called with the new size in pixels when the preview
+	// changes size.
+	OnResized func(width, height int)
+
+	// The following are called with positions given as offsets from the
+	// centre of the preview, in pixels.
+
+	// OnScrolled is called when the scroll wheel moves over the preview.
+	// steps is positive for scrolling up.
+	OnScrolled func(x, y, steps float64)
+	// OnTapped is called when the preview is clicked without dragging.
+	OnTapped func(x, y float64)
+	// OnDragStart, OnDragged and OnDragEnd are called as the mouse is dragged
+	// across the preview. OnDragStart gets the position that the drag
+	// started from.
+	OnDragStart func(x, y float64)
+	OnDragged   func(x, y float64)
+	OnDragEnd   func()
+	// OnHover is called as the mouse moves over the preview, and OnHoverEnd
+	// when it leaves.
+	OnHover    func(x, y float64)
+	OnHoverEnd func()
+
+	overlay  Overlay
+	dragging bool
+}
+
+// Point is a position in the preview, as an offset from its centre in pixels.
+type Point struct {
+	X, Y float64
+}
+
+// Overlay is drawn over the preview image, for example to show the crop.
+type Overlay struct {
+	// Outlines are drawn as closed shapes.
+	Outlines [][]Point
+	// Handles are drawn as small squares that can be dragged.
+	Handles []Point
 }
 
-func NewPreview(w, h int) Preview {
+func NewPreview(w, h int) *Preview {
 	i := image.NewRGBA(image.Rect(0, 0, 1, 1))
 	i.Set(0, 0, color.RGBA{0, 0, 0, 0})
 	img := canvas.NewImageFromImage(i)
 	img.FillMode = canvas.ImageFillContain
-	img.SetMinSize(fyne.NewSize(float32(w), float32(h)))
-	p := Preview{
-		Image:     img,
-		Container: container.NewCenter(img),
-		Width:     w,
-		Height:    h,
+	p := &Preview{
+		Image:  img,
+		Width:  w,
+		Height: h,
 	}
-
+	p.ExtendBaseWidget(p)
 	return p
 }
 
-func (p Preview) SetImage(img image.Image) {
+func (p *Preview) CreateRenderer() fyne.WidgetRenderer {
+	r := &previewRenderer{p: p}
+	r.Refresh()
+	return r
+}
+
+// SetOverlay replaces what is drawn over the preview image.
+func (p *Preview) SetOverlay(o Overlay) {
+	p.overlay = o
+	p.Refresh()
+}
+
+func (p *Preview) MinSize() fyne.Size {
+	return fyne.NewSize(MinWidth, MinHeight)
+}
+
+func (p *Preview) Resize(size fyne.Size) {
+	p.BaseWidget.Resize(size)
+	scale := p.scale()
+	w := int(math.Round(float64(size.Width * scale)))
+	h := int(math.Round(float64(size.Height * scale)))
+	if w <= 0 || h <= 0 || (w == p.Width && h == p.Height) {
+		return
+	}
+	p.Width = w
+	p.Height = h
+	if p.OnResized != nil {
+		p.OnResized(w, h)
+	}
+}
+
+// scrollNotch is how far fyne scrolls for one notch of a mouse wheel.
+const scrollNotch = 10
+
+func (p *Preview) Scrolled(ev *fyne.ScrollEvent) {
+	if p.OnScrolled == nil {
+		return
+	}
+	x, y := p.offset(ev.Position)
+	p.OnScrolled(x, y, float64(ev.Scrolled.DY/scrollNotch))
+}
+
+func (p *Preview) Tapped(ev *fyne.PointEvent) {
+	if p.OnTapped != nil {
+		p.OnTapped(p.offset(ev.Position))
+	}
+}
+
+func (p *Preview) Dragged(ev *fyne.DragEvent) {
+	if !p.dragging {
+		p.dragging = true
+		if p.OnDragStart != nil {
+			x, y := p.offset(ev.Position.Subtract(ev.Dragged))
+			p.OnDragStart(x, y)
+		}
+	}
+	if p.OnDragged != nil {
+		p.OnDragged(p.offset(ev.Position))
+	}
+}
+
+func (p *Preview) DragEnd() {
+	p.dragging = false
+	if p.OnDragEnd != nil {
+		p.OnDragEnd()
+	}
+}
+
+func (p *Preview) MouseIn(ev *desktop.MouseEvent) {
+	p.MouseMoved(ev)
+}
+
+func (p *Preview) MouseMoved(ev *desktop.MouseEvent) {
+	if p.OnHover != nil {
+		p.OnHover(p.offset(ev.Position))
+	}
+}
+
+func (p *Preview) MouseOut() {
+	if p.OnHoverEnd != nil {
+		p.OnHoverEnd()
+	}
+}
+
+// position converts an offset from the centre in pixels to a position within
+// the widget. It is the inverse of offset.
+func (p *Preview) position(pt Point) fyne.Position {
+	scale := p.scale()
+	size := p.Size()
+	return fyne.NewPos(size.Width/2+float32(pt.X)/scale, size.Height/2+float32(pt.Y)/scale)
+}
+
+// offset converts a position within the widget to pixels from its centre.
+func (p *Preview) offset(pos fyne.Position) (x, y float64) {
+	scale := p.scale()
+	size := p.Size()
+	return float64((pos.X - size.Width/2) * scale), float64((pos.Y - size.Height/2) * scale)
+}
+
+func (p *Preview) scale() float32 {
+	if c := fyne.CurrentApp().Driver().CanvasForObject(p); c != nil {
+		return c.Scale()
+	}
+	return 1
+}
+
+func (p *Preview) SetImage(img image.Image) {
 	p.Image.Image = img
 	r := img.Bounds()
 	if r.Dx() < p.Width && r.Dy() < p.Height {
@@ -40,6 +195,70 @@ func (p Preview) SetImage(img image.Image) {
 	} else {
 		p.Image.FillMode = canvas.ImageFillContain
 	}
-	p.Image.SetMinSize(fyne.NewSize(float32(p.Width), float32(p.Height)))
 	p.Image.Refresh()
 }
+
+// HandleSize is the width of overlay handles.
+const HandleSize = 8
+
+type previewRenderer struct {
+	p       *Preview
+	lines   []*canvas.Line
+	handles []*canvas.Rectangle
+}
+
+func (r *previewRenderer) Layout(size fyne.Size) {
+	r.p.Image.Move(fyne.NewPos(0, 0))
+	r.p.Image.Resize(size)
+	i := 0
+	for _, outline := range r.p.overlay.Outlines {
+		for j := range outline {
+			r.lines[i].Position1 = r.p.position(outline[j])
+			r.lines[i].Position2 = r.p.position(outline[(j+1)%len(outline)])
+			i++
+		}
+	}
+	for i, pt := range r.p.overlay.Handles {
+		pos := r.p.position(pt)
+		r.handles[i].Move(pos.SubtractXY(HandleSize/2, HandleSize/2))
+		r.handles[i].Resize(fyne.NewSquareSize(HandleSize))
+	}
+}
+
+func (r *previewRenderer) MinSize() fyne.Size {
+	return r.p.MinSize()
+}
+
+func (r *previewRenderer) Refresh() {
+	stroke := theme.Color(theme.ColorNamePrimary)
+	r.lines = r.lines[:0]
+	for _, outline := range r.p.overlay.Outlines {
+		for range outline {
+			l := canvas.NewLine(stroke)
+			l.StrokeWidth = 2
+			r.lines = append(r.lines, l)
+		}
+	}
+	r.handles = r.handles[:0]
+	for range r.p.overlay.Handles {
+		h := canvas.NewRectangle(theme.Color(theme.ColorNameBackground))
+		h.StrokeColor = stroke
+		h.StrokeWidth = 2
+		r.handles = append(r.handles, h)
+	}
+	r.Layout(r.p.Size())
+	r.p.Image.Refresh()
+}
+
+func (r *previewRenderer) Objects() []fyne.CanvasObject {
+	objects := []fyne.CanvasObject{r.p.Image}
+	for _, l := range r.lines {
+		objects = append(objects, l)
+	}
+	for _, h := range r.handles {
+		objects = append(objects, h)
+	}
+	return objects
+}
+
+func (r *previewRenderer) Destroy() {}
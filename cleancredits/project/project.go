@@ -0,0 +1,77 @@
+// Package project saves and loads the settings needed to clean a source
+// without the GUI.
+package project
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/sandalwoodbox/go-cleancredits/cleancredits/settings"
+)
+
+// Extension is the file extension used for saved projects.
+const Extension = ".ccproj"
+
+type Project struct {
+	Source settings.Source
+	Mask   settings.Mask
+	Render settings.Render
+}
+
+func Load(path string) (Project, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return Project{}, fmt.Errorf("reading project: %v", err)
+	}
+	var p Project
+	err = json.Unmarshal(b, &p)
+	if err != nil {
+		return Project{}, fmt.Errorf("parsing project: %v", err)
+	}
+	var legacy legacyProject
+	err = json.Unmarshal(b, &legacy)
+	if err != nil {
+		return Project{}, fmt.Errorf("parsing project: %v", err)
+	}
+	legacy.migrate(&p)
+	return p, nil
+}
+
+// legacyProject holds the fields of projects saved before the color ranges
+// were stored as settings.Mask's Min and Max.
+type legacyProject struct {
+	Mask struct {
+		Min *[3]int
+		Max *[3]int
+		// HueMin to ValMax were the ranges of the first, second and third
+		// channels, whatever the color space.
+		HueMin int
+		HueMax int
+		SatMin int
+		SatMax int
+		ValMin int
+		ValMax int
+	}
+}
+
+// migrate copies the legacy color ranges to p, unless it already has ranges.
+func (l legacyProject) migrate(p *Project) {
+	if l.Mask.Min != nil || l.Mask.Max != nil {
+		return
+	}
+	p.Mask.Min = [3]int{l.Mask.HueMin, l.Mask.SatMin, l.Mask.ValMin}
+	p.Mask.Max = [3]int{l.Mask.HueMax, l.Mask.SatMax, l.Mask.ValMax}
+}
+
+func (p Project) Save(path string) error {
+	b, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding project: %v", err)
+	}
+	err = os.WriteFile(path, b, 0644)
+	if err != nil {
+		return fmt.Errorf("writing project: %v", err)
+	}
+	return nil
+}
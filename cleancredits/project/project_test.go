@@ -0,0 +1,63 @@
+package project
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sandalwoodbox/go-cleancredits/cleancredits/settings"
+)
+
+func TestLoad_legacyRanges(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "legacy"+Extension)
+	legacy := `{
+  "Mask": {
+    "ColorSpace": "Lab",
+    "HueMin": 10,
+    "HueMax": 20,
+    "SatMin": 30,
+    "SatMax": 40,
+    "ValMin": 50,
+    "ValMax": 60
+  }
+}`
+	err := os.WriteFile(path, []byte(legacy), 0644)
+	if err != nil {
+		t.Fatalf("Error writing project: %v", err)
+	}
+	p, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	wantMin := [3]int{10, 30, 50}
+	wantMax := [3]int{20, 40, 60}
+	if p.Mask.Min != wantMin || p.Mask.Max != wantMax {
+		t.Errorf("ranges = %v-%v, want %v-%v", p.Mask.Min, p.Mask.Max, wantMin, wantMax)
+	}
+}
+
+func TestSave_roundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "project"+Extension)
+	want := Project{
+		Source: settings.Source{Path: "credits.mp4", Kind: "video"},
+		Mask: settings.Mask{
+			ColorSpace: "YCrCb",
+			Min:        [3]int{0, 100, 0},
+			Max:        [3]int{150, 255, 120},
+		},
+		Render: settings.Render{InpaintRadius: 3},
+	}
+	err := want.Save(path)
+	if err != nil {
+		t.Fatalf("Save returned error: %v", err)
+	}
+	got, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if got.Source != want.Source || got.Render != want.Render ||
+		got.Mask.ColorSpace != want.Mask.ColorSpace ||
+		got.Mask.Min != want.Mask.Min || got.Mask.Max != want.Mask.Max {
+		t.Errorf("Load = %+v, want %+v", got, want)
+	}
+}
@@ -2,6 +2,7 @@ package render
 
 import (
 	"fmt"
+	"strings"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/container"
@@ -12,10 +13,15 @@ import (
 	"gocv.io/x/gocv"
 
 	"github.com/sandalwoodbox/go-cleancredits/cleancredits/pipeline"
+	"github.com/sandalwoodbox/go-cleancredits/cleancredits/project"
 	"github.com/sandalwoodbox/go-cleancredits/cleancredits/settings"
 	ccWidget "github.com/sandalwoodbox/go-cleancredits/cleancredits/widget"
 )
 
+// DefaultCodec is used when rendering a source that has no codec of its own
+// (such as an image sequence) to a video file.
+const DefaultCodec = "mp4v"
+
 type Form struct {
 	Container     *fyne.Container
 	Window        fyne.Window
@@ -53,7 +59,7 @@ func NewForm(frameCount int, p *pipeline.Pipeline, w fyne.Window) Form {
 			widget.NewLabel("Start frame"), ccWidget.NewIntSliderWithData(0, frameCount-1, f.StartFrame), ccWidget.NewIntEntryWithData(0, frameCount-1, f.StartFrame),
 			widget.NewLabel("End frame"), ccWidget.NewIntSliderWithData(0, frameCount-1, f.EndFrame), ccWidget.NewIntEntryWithData(0, frameCount-1, f.EndFrame),
 			widget.NewLabel("Inpaint radius"), ccWidget.NewIntSliderWithData(0, 10, f.InpaintRadius), ccWidget.NewIntEntryWithData(0, frameCount-1, f.InpaintRadius),
-			widget.NewButton("Render", f.ShowRenderSave), widget.NewLabel(""), widget.NewLabel(""),
+			widget.NewButton("Render", f.ShowRenderSave), widget.NewButton("Save project", f.ShowProjectSave), widget.NewLabel(""),
 		),
 		container.New(
 			layout.NewVBoxLayout(),
@@ -138,6 +144,39 @@ func (f *Form) ShowRenderSave() {
 	}, f.Window)
 }
 
+// ShowProjectSave saves the current source, mask and render settings so that
+// they can be applied without the GUI (see the -y4m flag).
+func (f *Form) ShowProjectSave() {
+	d := dialog.NewFileSave(func(writer fyne.URIWriteCloser, err error) {
+		if err != nil {
+			dialog.ShowError(fmt.Errorf("error choosing save file: %v", err), f.Window)
+			return
+		}
+		if writer == nil {
+			fmt.Println("No file selected")
+			return
+		}
+		path := writer.URI().Path()
+		writer.Close()
+		rs, err := f.Settings()
+		if err != nil {
+			dialog.ShowError(fmt.Errorf("error getting render settings: %v", err), f.Window)
+			return
+		}
+		p := project.Project{
+			Source: f.Pipeline.Source,
+			Mask:   f.Pipeline.CurrentMaskSettings(),
+			Render: rs,
+		}
+		err = p.Save(path)
+		if err != nil {
+			dialog.ShowError(err, f.Window)
+		}
+	}, f.Window)
+	d.SetFileName("untitled" + project.Extension)
+	d.Show()
+}
+
 func (f *Form) Render(path string) {
 	f.ProgressLabel.SetText("")
 	f.ProgressLabel.Show()
@@ -156,20 +195,32 @@ func (f *Form) Render(path string) {
 	f.ProgressBar.SetValue(0)
 	f.ProgressBar.Show()
 
-	codec := f.Pipeline.VideoCapture.CodecString()
-	fps := f.Pipeline.VideoCapture.Get(gocv.VideoCaptureFPS)
+	codec := f.Pipeline.Capture.CodecString()
+	if strings.Trim(codec, "\x00") == "" {
+		codec = DefaultCodec
+	}
+	fps := f.Pipeline.Capture.Get(gocv.VideoCaptureFPS)
 
-	mask, err := pipeline.ImageToMatGray(*f.Pipeline.MaskWithOverrides)
+	// The preview may be using a proxy mask, so always render with the full
+	// resolution one.
+	mask, err := f.Pipeline.FullMask()
 	if err != nil {
 		mask.Close()
 		fyne.Do(func() {
-			f.ProgressLabel.SetText(fmt.Sprintf("converting MaskWithOverrides to mat: %v", err))
+			f.ProgressLabel.SetText(fmt.Sprintf("Error getting mask: %v", err))
 		})
 		return
 	}
 	defer mask.Close()
 
-	out, err := gocv.VideoWriterFile(path, codec, fps, f.Pipeline.VideoWidth, f.Pipeline.VideoHeight, true)
+	out, err := pipeline.NewFrameWriter(path, codec, fps, f.Pipeline.VideoWidth, f.Pipeline.VideoHeight, frameCount)
+	if err != nil {
+		fyne.Do(func() {
+			f.ProgressLabel.SetText(fmt.Sprintf("Error opening output: %v", err))
+		})
+		return
+	}
+	regions := pipeline.InpaintRegions(mask, rs.InpaintRadius)
 	masked := gocv.NewMat()
 	defer masked.Close()
 	for i := rs.StartFrame; i <= rs.EndFrame; i++ {
@@ -188,13 +239,21 @@ func (f *Form) Render(path string) {
 			f.ProgressLabel.SetText(fmt.Sprintf("%d/%d rendering frame...", i, rs.EndFrame))
 		})
 
-		gocv.Inpaint(mat, mask, &masked, float32(rs.InpaintRadius), gocv.Telea)
+		pipeline.InpaintWithRegions(mat, mask, &masked, rs.InpaintRadius, regions)
+		mat.Close()
 		fyne.Do(func() {
 			f.ProgressBar.SetValue(f.ProgressBar.Value + 1)
 			f.ProgressLabel.SetText(fmt.Sprintf("%d/%d saving frame...", i, rs.EndFrame))
 		})
 
-		out.Write(masked)
+		err = out.Write(f.Pipeline.FrameNumber(i), masked)
+		if err != nil {
+			fyne.Do(func() {
+				f.ProgressLabel.SetText(fmt.Sprintf("Error saving frame %d: %v", i, err))
+			})
+			out.Close()
+			return
+		}
 		fyne.Do(func() {
 			f.ProgressBar.SetValue(f.ProgressBar.Value + 1)
 		})
@@ -0,0 +1,101 @@
+package scheduler
+
+import (
+	"context"
+	"sync"
+)
+
+// Scheduler runs a task in the background each time it is scheduled. At most
+// one run is in progress at a time. Scheduling while the task is running
+// cancels the running task's context and queues a single new run, so a burst
+// of changes (for example from dragging a slider) only runs the task for the
+// latest state.
+type Scheduler struct {
+	task func(ctx context.Context)
+
+	mu      sync.Mutex
+	idle    *sync.Cond
+	running bool
+	pending bool
+	closed  bool
+	cancel  context.CancelFunc
+}
+
+// New returns a Scheduler that runs task. task should stop early (and
+// discard its results) once ctx is cancelled.
+func New(task func(ctx context.Context)) *Scheduler {
+	s := &Scheduler{task: task}
+	s.idle = sync.NewCond(&s.mu)
+	return s
+}
+
+// Schedule makes sure that the task runs after this call, cancelling the
+// current run if there is one. It never blocks.
+func (s *Scheduler) Schedule() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	s.pending = true
+	if s.running {
+		// cancel is nil if the loop hasn't started the first run yet.
+		if s.cancel != nil {
+			s.cancel()
+		}
+		return
+	}
+	s.running = true
+	go s.loop()
+}
+
+// Wait blocks until the task has finished running and nothing is scheduled.
+func (s *Scheduler) Wait() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for s.running {
+		s.idle.Wait()
+	}
+}
+
+// Close cancels the current run and stops any further runs. It doesn't wait
+// for the current run to return; use Wait for that.
+func (s *Scheduler) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	s.pending = false
+	if s.running && s.cancel != nil {
+		s.cancel()
+	}
+}
+
+func (s *Scheduler) loop() {
+	for {
+		ctx, cancel, ok := s.next()
+		if !ok {
+			return
+		}
+		s.run(ctx, cancel)
+	}
+}
+
+// next starts the pending run, returning false if there isn't one.
+func (s *Scheduler) next() (context.Context, context.CancelFunc, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.pending || s.closed {
+		s.running = false
+		s.idle.Broadcast()
+		return nil, nil, false
+	}
+	s.pending = false
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	return ctx, cancel, true
+}
+
+func (s *Scheduler) run(ctx context.Context, cancel context.CancelFunc) {
+	defer cancel()
+	s.task(ctx)
+}
@@ -0,0 +1,120 @@
+package scheduler
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestScheduler_concurrent(t *testing.T) {
+	var scheduled atomic.Int64
+	var active atomic.Int32
+	var runs atomic.Int32
+	var lastSeen atomic.Int64
+	s := New(func(ctx context.Context) {
+		if active.Add(1) != 1 {
+			t.Error("task is running more than once at the same time")
+		}
+		defer active.Add(-1)
+		runs.Add(1)
+		lastSeen.Store(scheduled.Load())
+		time.Sleep(time.Millisecond)
+	})
+
+	const goroutines = 20
+	const schedules = 500
+	var wg sync.WaitGroup
+	for range goroutines {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range schedules {
+				scheduled.Add(1)
+				s.Schedule()
+			}
+		}()
+	}
+	wg.Wait()
+	s.Wait()
+
+	// Every change must be seen by a run that started after it.
+	if got, want := lastSeen.Load(), int64(goroutines*schedules); got != want {
+		t.Errorf("last run saw %d changes, want %d", got, want)
+	}
+	if runs.Load() >= goroutines*schedules {
+		t.Errorf("%d runs for %d schedules; updates weren't coalesced", runs.Load(), goroutines*schedules)
+	}
+}
+
+func TestScheduler_coalesces(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var runs atomic.Int32
+	s := New(func(ctx context.Context) {
+		if runs.Add(1) == 1 {
+			close(started)
+			<-release
+		}
+	})
+	s.Schedule()
+	<-started
+	for range 100 {
+		s.Schedule()
+	}
+	close(release)
+	s.Wait()
+	if got := runs.Load(); got != 2 {
+		t.Errorf("task ran %d times, want 2", got)
+	}
+}
+
+func TestScheduler_cancelsStaleRuns(t *testing.T) {
+	started := make(chan struct{})
+	cancelled := make(chan bool, 1)
+	var runs atomic.Int32
+	s := New(func(ctx context.Context) {
+		if runs.Add(1) != 1 {
+			return
+		}
+		close(started)
+		select {
+		case <-ctx.Done():
+			cancelled <- true
+		case <-time.After(5 * time.Second):
+			cancelled <- false
+		}
+	})
+	s.Schedule()
+	<-started
+	s.Schedule()
+	if !<-cancelled {
+		t.Error("scheduling again didn't cancel the running task")
+	}
+	s.Wait()
+	if got := runs.Load(); got != 2 {
+		t.Errorf("task ran %d times, want 2", got)
+	}
+}
+
+func TestScheduler_Close(t *testing.T) {
+	started := make(chan struct{})
+	var runs atomic.Int32
+	s := New(func(ctx context.Context) {
+		if runs.Add(1) == 1 {
+			close(started)
+		}
+		<-ctx.Done()
+	})
+	s.Schedule()
+	<-started
+	s.Schedule()
+	s.Close()
+	s.Wait()
+	s.Schedule()
+	s.Wait()
+	if got := runs.Load(); got != 1 {
+		t.Errorf("task ran %d times, want 1", got)
+	}
+}
@@ -1,10 +1,16 @@
 package settings
 
+import (
+	"image"
+	"image/color"
+)
+
 type Display struct {
 	Mode    string
 	Zoom    float64
 	AnchorX int
 	AnchorY int
+	Proxy   bool
 }
 
 type Draw struct {
@@ -12,19 +18,67 @@ type Draw struct {
 }
 
 type Mask struct {
-	Frame      int
-	Mode       string
-	HueMin     int
-	HueMax     int
-	SatMin     int
-	SatMax     int
-	ValMin     int
-	ValMax     int
-	Grow       int
+	Frame int
+	Mode  string
+	// Method is how pixels are selected: by the color ranges below, or by
+	// their distance from ReferenceColors. It defaults to the color ranges.
+	Method string
+	// ColorSpace is the color space that the ranges below select from. It
+	// defaults to HSV.
+	ColorSpace string
+	// Min and Max are the ranges of the three channels of ColorSpace, in
+	// OpenCV's 8 bit units: H/S/V, H/L/S, L/a/b, Y/Cr/Cb or R/G/B. A hue
+	// range wraps around when Min is greater than Max.
+	Min  [3]int
+	Max  [3]int
+	Grow int
+	// Shrink, Open and Close are the sizes of the other morphological
+	// operations, which are applied before Grow. Kernel is the shape of the
+	// kernel for all four, and defaults to a rectangle.
+	Shrink     int
+	Open       int
+	Close      int
+	Kernel     string
 	CropLeft   int
 	CropTop    int
 	CropRight  int
 	CropBottom int
+	// Crops limits the mask to the union of several regions. If it is empty,
+	// the rectangle given by CropLeft, CropTop, CropRight and CropBottom is
+	// used instead.
+	Crops []Crop
+	// ReferenceColors and DeltaE select pixels within a perceptual distance
+	// (CIE76 Delta E) of any of the colors.
+	ReferenceColors []color.RGBA
+	DeltaE          int
+	// MinArea, MaxArea, MinAspect, MaxAspect, MinSolidity and MaxSolidity
+	// remove connected components of the color selection, before the
+	// morphological operations: by their area in pixels, the width / height
+	// of their bounding box, and their area as a percentage of their convex
+	// hull's. Zero means no limit.
+	MinArea     int
+	MaxArea     int
+	MinAspect   float64
+	MaxAspect   float64
+	MinSolidity int
+	MaxSolidity int
+}
+
+// Crop is a region of the frame that a mask is limited to.
+type Crop struct {
+	Shape string
+	// Left, Top, Right and Bottom bound rectangles and ellipses.
+	Left   int
+	Top    int
+	Right  int
+	Bottom int
+	// Points are the vertices of a polygon.
+	Points []image.Point
+}
+
+type Source struct {
+	Path string
+	Kind string
 }
 
 type Render struct {
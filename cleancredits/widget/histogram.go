@@ -0,0 +1,179 @@
+package widget
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/data/binding"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+)
+
+// histogramHeight is the height of a Histogram's bars.
+const histogramHeight = 40
+
+// Histogram plots how many times each value from Min to Max occurs, with
+// lines at Low and High. Values between them are highlighted; as with
+// IntRangeSlider, Low may be greater than High for a range that wraps
+// around if Wrap is set. It lines up with an IntRangeSlider of the same
+// width.
+type Histogram struct {
+	widget.BaseWidget
+	Min, Max  int
+	Low, High int
+	// Wrap is true if the values are circular, such as hues.
+	Wrap bool
+	// Counts has one count for each value from Min to Max.
+	Counts []int
+}
+
+func NewHistogram(min, max int) *Histogram {
+	h := &Histogram{
+		Min:  min,
+		Max:  max,
+		High: max,
+	}
+	h.ExtendBaseWidget(h)
+	return h
+}
+
+func NewHistogramWithData(min, max int, low, high binding.Int) *Histogram {
+	h := NewHistogram(min, max)
+	h.Bind(low, high)
+	return h
+}
+
+// Bind moves the lines to follow low and high.
+func (h *Histogram) Bind(low, high binding.Int) {
+	l := binding.NewDataListener(func() {
+		lo, err := low.Get()
+		if err != nil {
+			fmt.Println("Error getting histogram low: ", err)
+			return
+		}
+		hi, err := high.Get()
+		if err != nil {
+			fmt.Println("Error getting histogram high: ", err)
+			return
+		}
+		h.Low = lo
+		h.High = hi
+		h.Refresh()
+	})
+	low.AddListener(l)
+	high.AddListener(l)
+}
+
+// SetRange changes the values that are plotted.
+func (h *Histogram) SetRange(min, max int) {
+	h.Min = min
+	h.Max = max
+	h.Refresh()
+}
+
+// SetWrap changes whether the range can wrap around.
+func (h *Histogram) SetWrap(wrap bool) {
+	h.Wrap = wrap
+	h.Refresh()
+}
+
+// SetCounts changes the counts that are plotted.
+func (h *Histogram) SetCounts(counts []int) {
+	h.Counts = counts
+	h.Refresh()
+}
+
+func (h *Histogram) selected(v int) bool {
+	if h.Low <= h.High {
+		return v >= h.Low && v <= h.High
+	}
+	return h.Wrap && (v >= h.Low || v <= h.High)
+}
+
+func (h *Histogram) MinSize() fyne.Size {
+	return fyne.NewSize(thumbSize*4, histogramHeight)
+}
+
+func (h *Histogram) CreateRenderer() fyne.WidgetRenderer {
+	r := &histogramRenderer{
+		h:     h,
+		lines: [2]*canvas.Line{canvas.NewLine(color.Transparent), canvas.NewLine(color.Transparent)},
+	}
+	r.bars = canvas.NewRasterWithPixels(r.barPixel)
+	r.Refresh()
+	return r
+}
+
+type histogramRenderer struct {
+	h     *Histogram
+	bars  *canvas.Raster
+	lines [2]*canvas.Line
+	// peak is the largest count, which fills the height.
+	peak int
+}
+
+// barPixel colors the bar for the value at x. Bar heights are the square
+// root of the counts, so that small clusters are still visible next to a
+// large background.
+func (r *histogramRenderer) barPixel(x, y, w, ht int) color.Color {
+	h := r.h
+	if r.peak == 0 || len(h.Counts) == 0 {
+		return color.Transparent
+	}
+	v := h.Min
+	if w > 1 {
+		v = h.Min + int(math.Round(float64(x)/float64(w-1)*float64(h.Max-h.Min)))
+	}
+	i := v - h.Min
+	if i < 0 || i >= len(h.Counts) {
+		return color.Transparent
+	}
+	height := math.Sqrt(float64(h.Counts[i])/float64(r.peak)) * float64(ht)
+	if float64(ht-y) > height {
+		return color.Transparent
+	}
+	if h.selected(v) {
+		return theme.Color(theme.ColorNameForeground)
+	}
+	return theme.Color(theme.ColorNameDisabled)
+}
+
+func (r *histogramRenderer) Layout(size fyne.Size) {
+	h := r.h
+	start := valuePosition(size.Width, h.Min, h.Max, h.Min)
+	end := valuePosition(size.Width, h.Min, h.Max, h.Max)
+	r.bars.Move(fyne.NewPos(start, 0))
+	r.bars.Resize(fyne.NewSize(max(end-start, 0), size.Height))
+	for i, v := range []int{h.Low, h.High} {
+		x := valuePosition(size.Width, h.Min, h.Max, v)
+		r.lines[i].Position1 = fyne.NewPos(x, 0)
+		r.lines[i].Position2 = fyne.NewPos(x, size.Height)
+	}
+}
+
+func (r *histogramRenderer) MinSize() fyne.Size {
+	return r.h.MinSize()
+}
+
+func (r *histogramRenderer) Refresh() {
+	r.peak = 0
+	for _, c := range r.h.Counts {
+		r.peak = max(r.peak, c)
+	}
+	for _, l := range r.lines {
+		l.StrokeColor = theme.Color(theme.ColorNamePrimary)
+		l.StrokeWidth = 2
+	}
+	r.Layout(r.h.Size())
+	r.bars.Refresh()
+	canvas.Refresh(r.h)
+}
+
+func (r *histogramRenderer) Objects() []fyne.CanvasObject {
+	return []fyne.CanvasObject{r.bars, r.lines[0], r.lines[1]}
+}
+
+func (r *histogramRenderer) Destroy() {}
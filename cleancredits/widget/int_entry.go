@@ -80,3 +80,10 @@ func (e *IntEntry) TypedKey(key *fyne.KeyEvent) {
 	}
 	e.Entry.TypedKey(key)
 }
+
+// SetRange changes the values that the arrow keys and scroll wheel step
+// between.
+func (e *IntEntry) SetRange(min, max int) {
+	e.Min = min
+	e.Max = max
+}
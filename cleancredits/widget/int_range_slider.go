@@ -0,0 +1,393 @@
+package widget
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/data/binding"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+
+	"github.com/sandalwoodbox/go-cleancredits/cleancredits/utils"
+)
+
+// thumbSize is the diameter of an IntRangeSlider's thumbs.
+const thumbSize = 16
+
+// IntRangeSlider selects a range of ints with two thumbs. If Wrap is set, Low
+// may be greater than High, in which case the selected range wraps around
+// past Max back to Min. Otherwise a thumb pushes the other one along when it
+// is moved past it.
+type IntRangeSlider struct {
+	widget.BaseWidget
+	Min, Max  int
+	Low, High int
+	// Wrap is true if the values are circular, such as hues.
+	Wrap bool
+	// OnChanged is called when the user moves either thumb.
+	OnChanged func(low, high int)
+	// Gradient, if set, is drawn instead of the track, with one color for
+	// each value from Min to Max. Values outside the range are dimmed.
+	Gradient []color.Color
+
+	low, high binding.Int
+	// active is the thumb that is being dragged or that the arrow keys move:
+	// 0 for Low and 1 for High.
+	active   int
+	dragging bool
+	focused  bool
+}
+
+func NewIntRangeSlider(min, max int) *IntRangeSlider {
+	s := &IntRangeSlider{
+		Min:  min,
+		Max:  max,
+		High: max,
+	}
+	s.ExtendBaseWidget(s)
+	return s
+}
+
+func NewIntRangeSliderWithData(min, max int, low, high binding.Int) *IntRangeSlider {
+	s := NewIntRangeSlider(min, max)
+	s.Bind(low, high)
+	return s
+}
+
+// Bind connects the thumbs to low and high.
+func (s *IntRangeSlider) Bind(low, high binding.Int) {
+	s.low = low
+	s.high = high
+	l := binding.NewDataListener(func() {
+		lo, err := s.low.Get()
+		if err != nil {
+			fmt.Println("Error getting range low: ", err)
+			return
+		}
+		hi, err := s.high.Get()
+		if err != nil {
+			fmt.Println("Error getting range high: ", err)
+			return
+		}
+		s.Low = lo
+		s.High = hi
+		s.Refresh()
+	})
+	low.AddListener(l)
+	high.AddListener(l)
+}
+
+// SetRange changes the values that the thumbs can be set to.
+func (s *IntRangeSlider) SetRange(min, max int) {
+	s.Min = min
+	s.Max = max
+	s.Refresh()
+}
+
+// SetGradient changes the colors drawn behind the thumbs.
+func (s *IntRangeSlider) SetGradient(gradient []color.Color) {
+	s.Gradient = gradient
+	s.Refresh()
+}
+
+// SetWrap changes whether the range can wrap around.
+func (s *IntRangeSlider) SetWrap(wrap bool) {
+	s.Wrap = wrap
+	s.Refresh()
+}
+
+// selected returns true if v is within the range, taking wrapping into
+// account.
+func (s *IntRangeSlider) selected(v int) bool {
+	if s.Low <= s.High {
+		return v >= s.Low && v <= s.High
+	}
+	return s.Wrap && (v >= s.Low || v <= s.High)
+}
+
+// SetValues moves the thumbs to low and high. Unless Wrap is set, they are
+// swapped if low is greater than high.
+func (s *IntRangeSlider) SetValues(low, high int) {
+	low = utils.ClampInt(low, s.Min, s.Max)
+	high = utils.ClampInt(high, s.Min, s.Max)
+	if !s.Wrap && low > high {
+		low, high = high, low
+	}
+	if low == s.Low && high == s.High {
+		return
+	}
+	s.Low = low
+	s.High = high
+	if s.low != nil {
+		err := s.low.Set(low)
+		if err != nil {
+			fmt.Println("Error setting range low: ", err)
+		}
+	}
+	if s.high != nil {
+		err := s.high.Set(high)
+		if err != nil {
+			fmt.Println("Error setting range high: ", err)
+		}
+	}
+	if s.OnChanged != nil {
+		s.OnChanged(low, high)
+	}
+	s.Refresh()
+}
+
+// setActive moves the active thumb to v. Unless Wrap is set, the other thumb
+// is pushed along if v is past it.
+func (s *IntRangeSlider) setActive(v int) {
+	v = utils.ClampInt(v, s.Min, s.Max)
+	if s.active == 0 {
+		high := s.High
+		if !s.Wrap {
+			high = max(high, v)
+		}
+		s.SetValues(v, high)
+	} else {
+		low := s.Low
+		if !s.Wrap {
+			low = min(low, v)
+		}
+		s.SetValues(low, v)
+	}
+}
+
+func (s *IntRangeSlider) activeValue() int {
+	if s.active == 0 {
+		return s.Low
+	}
+	return s.High
+}
+
+// nearest makes the thumb closest to x active.
+func (s *IntRangeSlider) nearest(x float32) {
+	lo := math.Abs(float64(x - s.position(s.Low)))
+	hi := math.Abs(float64(x - s.position(s.High)))
+	if lo < hi || (lo == hi && x < s.position(s.Low)) {
+		s.active = 0
+	} else {
+		s.active = 1
+	}
+}
+
+// position returns the x coordinate of the centre of a thumb at v.
+func (s *IntRangeSlider) position(v int) float32 {
+	return valuePosition(s.Size().Width, s.Min, s.Max, v)
+}
+
+// valuePosition returns the x coordinate of v in a range slider that is width
+// wide and goes from min to max. The ends are inset by half a thumb, so that
+// the thumbs fit.
+func valuePosition(width float32, min, max, v int) float32 {
+	width -= thumbSize
+	if max <= min || width <= 0 {
+		return thumbSize / 2
+	}
+	return thumbSize/2 + width*float32(v-min)/float32(max-min)
+}
+
+// value returns the value at the x coordinate x.
+func (s *IntRangeSlider) value(x float32) int {
+	width := s.Size().Width - thumbSize
+	if s.Max <= s.Min || width <= 0 {
+		return s.Min
+	}
+	v := float64(s.Min) + float64(x-thumbSize/2)/float64(width)*float64(s.Max-s.Min)
+	return utils.ClampInt(int(math.Round(v)), s.Min, s.Max)
+}
+
+func (s *IntRangeSlider) Tapped(ev *fyne.PointEvent) {
+	s.nearest(ev.Position.X)
+	s.setActive(s.value(ev.Position.X))
+	if c := fyne.CurrentApp().Driver().CanvasForObject(s); c != nil {
+		c.Focus(s)
+	}
+}
+
+func (s *IntRangeSlider) Dragged(ev *fyne.DragEvent) {
+	if !s.dragging {
+		s.dragging = true
+		s.nearest(ev.Position.X - ev.Dragged.DX)
+	}
+	s.setActive(s.value(ev.Position.X))
+}
+
+func (s *IntRangeSlider) DragEnd() {
+	s.dragging = false
+}
+
+// Scrolled steps the thumb nearest the pointer.
+func (s *IntRangeSlider) Scrolled(ev *fyne.ScrollEvent) {
+	s.nearest(ev.Position.X)
+	s.setActive(s.activeValue() + int(ev.Scrolled.DY))
+}
+
+func (s *IntRangeSlider) FocusGained() {
+	s.focused = true
+	s.Refresh()
+}
+
+func (s *IntRangeSlider) FocusLost() {
+	s.focused = false
+	s.Refresh()
+}
+
+func (s *IntRangeSlider) TypedRune(rune) {}
+
+// TypedKey steps the active thumb with the arrow keys.
+func (s *IntRangeSlider) TypedKey(key *fyne.KeyEvent) {
+	switch key.Name {
+	case fyne.KeyUp, fyne.KeyRight:
+		s.setActive(s.activeValue() + 1)
+	case fyne.KeyDown, fyne.KeyLeft:
+		s.setActive(s.activeValue() - 1)
+	}
+}
+
+func (s *IntRangeSlider) MinSize() fyne.Size {
+	return fyne.NewSize(thumbSize*4, thumbSize+theme.Padding()*2)
+}
+
+func (s *IntRangeSlider) CreateRenderer() fyne.WidgetRenderer {
+	r := &intRangeSliderRenderer{
+		s:     s,
+		track: canvas.NewRectangle(theme.Color(theme.ColorNameInputBorder)),
+		bands: [2]*canvas.Rectangle{
+			canvas.NewRectangle(theme.Color(theme.ColorNamePrimary)),
+			canvas.NewRectangle(theme.Color(theme.ColorNamePrimary)),
+		},
+		thumbs: [2]*canvas.Circle{
+			canvas.NewCircle(theme.Color(theme.ColorNamePrimary)),
+			canvas.NewCircle(theme.Color(theme.ColorNamePrimary)),
+		},
+	}
+	r.gradient = canvas.NewRasterWithPixels(r.gradientPixel)
+	r.Refresh()
+	return r
+}
+
+type intRangeSliderRenderer struct {
+	s        *IntRangeSlider
+	track    *canvas.Rectangle
+	bands    [2]*canvas.Rectangle
+	gradient *canvas.Raster
+	thumbs   [2]*canvas.Circle
+}
+
+const (
+	// trackHeight is the height of the track and the selected band.
+	trackHeight = 4
+	// gradientHeight is the height of the gradient, if there is one.
+	gradientHeight = 10
+)
+
+// gradientPixel returns the color of the gradient at x. Values outside the
+// range are blended with the background.
+func (r *intRangeSliderRenderer) gradientPixel(x, _, w, _ int) color.Color {
+	s := r.s
+	if len(s.Gradient) == 0 {
+		return color.Transparent
+	}
+	v := s.Min
+	if w > 1 {
+		v = s.Min + int(math.Round(float64(x)/float64(w-1)*float64(s.Max-s.Min)))
+	}
+	c := s.Gradient[utils.ClampInt(v-s.Min, 0, len(s.Gradient)-1)]
+	if s.selected(v) {
+		return c
+	}
+	return blend(c, theme.Color(theme.ColorNameBackground))
+}
+
+// blend returns a color three quarters of the way from a to b.
+func blend(a, b color.Color) color.Color {
+	ar, ag, ab, _ := a.RGBA()
+	br, bg, bb, _ := b.RGBA()
+	return color.RGBA64{
+		R: uint16((ar + 3*br) / 4),
+		G: uint16((ag + 3*bg) / 4),
+		B: uint16((ab + 3*bb) / 4),
+		A: 0xffff,
+	}
+}
+
+func (r *intRangeSliderRenderer) Layout(size fyne.Size) {
+	s := r.s
+	y := size.Height / 2
+	line := func(rect *canvas.Rectangle, x0, x1 float32) {
+		rect.Move(fyne.NewPos(x0, y-trackHeight/2))
+		rect.Resize(fyne.NewSize(max(x1-x0, 0), trackHeight))
+	}
+	start, end := s.position(s.Min), s.position(s.Max)
+	lo, hi := s.position(s.Low), s.position(s.High)
+	line(r.track, start, end)
+	r.gradient.Move(fyne.NewPos(start, y-gradientHeight/2))
+	r.gradient.Resize(fyne.NewSize(max(end-start, 0), gradientHeight))
+	switch {
+	case len(s.Gradient) > 0:
+		// The gradient shows the range instead.
+		r.gradient.Show()
+		r.track.Hide()
+		r.bands[0].Hide()
+		r.bands[1].Hide()
+	case s.Low <= s.High || !s.Wrap:
+		// A range that doesn't wrap is empty if Low is greater than High.
+		r.gradient.Hide()
+		r.track.Show()
+		line(r.bands[0], lo, hi)
+		r.bands[0].Show()
+		r.bands[1].Hide()
+	default:
+		// The range wraps around.
+		r.gradient.Hide()
+		r.track.Show()
+		line(r.bands[0], start, hi)
+		line(r.bands[1], lo, end)
+		r.bands[0].Show()
+		r.bands[1].Show()
+	}
+	for i, v := range []int{s.Low, s.High} {
+		x := s.position(v)
+		r.thumbs[i].Move(fyne.NewPos(x-thumbSize/2, y-thumbSize/2))
+		r.thumbs[i].Resize(fyne.NewSquareSize(thumbSize))
+	}
+}
+
+func (r *intRangeSliderRenderer) MinSize() fyne.Size {
+	return r.s.MinSize()
+}
+
+func (r *intRangeSliderRenderer) Refresh() {
+	primary := theme.Color(theme.ColorNamePrimary)
+	r.track.FillColor = theme.Color(theme.ColorNameInputBorder)
+	for i := range r.bands {
+		r.bands[i].FillColor = primary
+		r.thumbs[i].FillColor = primary
+		r.thumbs[i].StrokeColor = theme.Color(theme.ColorNameForeground)
+		r.thumbs[i].StrokeWidth = 0
+		if len(r.s.Gradient) > 0 {
+			// Keep the thumbs visible against any color.
+			r.thumbs[i].StrokeWidth = 2
+		}
+	}
+	if r.s.focused {
+		// Outline the thumb that the arrow keys move.
+		r.thumbs[r.s.active].StrokeColor = theme.Color(theme.ColorNameFocus)
+		r.thumbs[r.s.active].StrokeWidth = 3
+	}
+	r.Layout(r.s.Size())
+	r.gradient.Refresh()
+	canvas.Refresh(r.s)
+}
+
+func (r *intRangeSliderRenderer) Objects() []fyne.CanvasObject {
+	return []fyne.CanvasObject{r.track, r.gradient, r.bands[0], r.bands[1], r.thumbs[0], r.thumbs[1]}
+}
+
+func (r *intRangeSliderRenderer) Destroy() {}
@@ -0,0 +1,170 @@
+package widget
+
+import (
+	"testing"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/data/binding"
+	"fyne.io/fyne/v2/test"
+)
+
+// newTestSlider returns a slider from 0 to 100, bound to low and high, that
+// is sized so that value v is at x = v + thumbSize/2.
+func newTestSlider(t *testing.T, low, high int, wrap bool) (*IntRangeSlider, binding.Int, binding.Int) {
+	test.NewTempApp(t)
+	lo := binding.NewInt()
+	hi := binding.NewInt()
+	if err := lo.Set(low); err != nil {
+		t.Fatalf("setting low: %v", err)
+	}
+	if err := hi.Set(high); err != nil {
+		t.Fatalf("setting high: %v", err)
+	}
+	s := NewIntRangeSliderWithData(0, 100, lo, hi)
+	s.Wrap = wrap
+	s.Resize(fyne.NewSize(100+thumbSize, 20))
+	return s, lo, hi
+}
+
+// assertValues checks the thumbs of s and the values bound to them.
+func assertValues(t *testing.T, s *IntRangeSlider, lo, hi binding.Int, wantLow, wantHigh int) {
+	t.Helper()
+	if s.Low != wantLow || s.High != wantHigh {
+		t.Errorf("slider = %d-%d, want %d-%d", s.Low, s.High, wantLow, wantHigh)
+	}
+	gotLow, err := lo.Get()
+	if err != nil {
+		t.Fatalf("getting low: %v", err)
+	}
+	gotHigh, err := hi.Get()
+	if err != nil {
+		t.Fatalf("getting high: %v", err)
+	}
+	if gotLow != wantLow || gotHigh != wantHigh {
+		t.Errorf("bound values = %d-%d, want %d-%d", gotLow, gotHigh, wantLow, wantHigh)
+	}
+}
+
+func TestIntRangeSlider_positions(t *testing.T) {
+	s, _, _ := newTestSlider(t, 0, 100, false)
+	for _, v := range []int{0, 1, 50, 99, 100} {
+		x := s.position(v)
+		if want := float32(v + thumbSize/2); x != want {
+			t.Errorf("position(%d) = %v, want %v", v, x, want)
+		}
+		if got := s.value(x); got != v {
+			t.Errorf("value(position(%d)) = %d", v, got)
+		}
+	}
+	if got := s.value(-10); got != 0 {
+		t.Errorf("value before the start = %d, want 0", got)
+	}
+	if got := s.value(1000); got != 100 {
+		t.Errorf("value after the end = %d, want 100", got)
+	}
+}
+
+func TestIntRangeSlider_Bind(t *testing.T) {
+	s, lo, hi := newTestSlider(t, 20, 80, false)
+	assertValues(t, s, lo, hi, 20, 80)
+	if err := lo.Set(30); err != nil {
+		t.Fatalf("setting low: %v", err)
+	}
+	if err := hi.Set(60); err != nil {
+		t.Fatalf("setting high: %v", err)
+	}
+	assertValues(t, s, lo, hi, 30, 60)
+}
+
+func TestIntRangeSlider_Tapped(t *testing.T) {
+	s, lo, hi := newTestSlider(t, 20, 80, false)
+	test.TapAt(s, fyne.NewPos(s.position(30), 10))
+	assertValues(t, s, lo, hi, 30, 80)
+	test.TapAt(s, fyne.NewPos(s.position(70), 10))
+	assertValues(t, s, lo, hi, 30, 70)
+}
+
+func TestIntRangeSlider_Dragged(t *testing.T) {
+	cases := []struct {
+		name              string
+		wrap              bool
+		from, to          int
+		wantLow, wantHigh int
+	}{
+		{name: "high", from: 80, to: 95, wantLow: 20, wantHigh: 95},
+		{name: "low", from: 20, to: 5, wantLow: 5, wantHigh: 80},
+		{name: "low pushes high", from: 20, to: 90, wantLow: 90, wantHigh: 90},
+		{name: "high pushes low", from: 80, to: 10, wantLow: 10, wantHigh: 10},
+		{name: "low wraps", wrap: true, from: 20, to: 90, wantLow: 90, wantHigh: 80},
+		{name: "high wraps", wrap: true, from: 80, to: 10, wantLow: 20, wantHigh: 10},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			s, lo, hi := newTestSlider(t, 20, 80, tc.wrap)
+			// Drag in two steps, as drivers send an event for each move.
+			mid := (tc.from + tc.to) / 2
+			s.Dragged(&fyne.DragEvent{
+				PointEvent: fyne.PointEvent{Position: fyne.NewPos(s.position(mid), 10)},
+				Dragged:    fyne.NewDelta(s.position(mid)-s.position(tc.from), 0),
+			})
+			s.Dragged(&fyne.DragEvent{
+				PointEvent: fyne.PointEvent{Position: fyne.NewPos(s.position(tc.to), 10)},
+				Dragged:    fyne.NewDelta(s.position(tc.to)-s.position(mid), 0),
+			})
+			s.DragEnd()
+			assertValues(t, s, lo, hi, tc.wantLow, tc.wantHigh)
+		})
+	}
+}
+
+func TestIntRangeSlider_Scrolled(t *testing.T) {
+	cases := []struct {
+		name              string
+		wrap              bool
+		at                int
+		dy                float32
+		wantLow, wantHigh int
+	}{
+		{name: "high up", at: 80, dy: 5, wantLow: 20, wantHigh: 85},
+		{name: "low down", at: 20, dy: -5, wantLow: 15, wantHigh: 80},
+		{name: "clamped", at: 80, dy: 50, wantLow: 20, wantHigh: 100},
+		{name: "low pushes high", at: 20, dy: 70, wantLow: 90, wantHigh: 90},
+		{name: "low wraps", wrap: true, at: 20, dy: 70, wantLow: 90, wantHigh: 80},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			s, lo, hi := newTestSlider(t, 20, 80, tc.wrap)
+			s.Scrolled(&fyne.ScrollEvent{
+				PointEvent: fyne.PointEvent{Position: fyne.NewPos(s.position(tc.at), 10)},
+				Scrolled:   fyne.NewDelta(0, tc.dy),
+			})
+			assertValues(t, s, lo, hi, tc.wantLow, tc.wantHigh)
+		})
+	}
+}
+
+func TestIntRangeSlider_TypedKey(t *testing.T) {
+	s, lo, hi := newTestSlider(t, 20, 21, false)
+	// The low thumb is active until another is tapped.
+	s.TypedKey(&fyne.KeyEvent{Name: fyne.KeyUp})
+	assertValues(t, s, lo, hi, 21, 21)
+	s.TypedKey(&fyne.KeyEvent{Name: fyne.KeyRight})
+	assertValues(t, s, lo, hi, 22, 22)
+	s.TypedKey(&fyne.KeyEvent{Name: fyne.KeyLeft})
+	assertValues(t, s, lo, hi, 21, 22)
+	s.active = 1
+	s.TypedKey(&fyne.KeyEvent{Name: fyne.KeyDown})
+	s.TypedKey(&fyne.KeyEvent{Name: fyne.KeyDown})
+	assertValues(t, s, lo, hi, 20, 20)
+}
+
+func TestIntRangeSlider_selected(t *testing.T) {
+	s, _, _ := newTestSlider(t, 80, 20, false)
+	if s.selected(90) || s.selected(50) || s.selected(10) {
+		t.Error("a range from 80 to 20 that doesn't wrap selected a value")
+	}
+	s.Wrap = true
+	if !s.selected(90) || s.selected(50) || !s.selected(10) {
+		t.Error("a range from 80 to 20 that wraps didn't select 80-100 and 0-20")
+	}
+}
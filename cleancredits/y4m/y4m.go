@@ -0,0 +1,230 @@
+// Package y4m reads and writes YUV4MPEG2 streams, converting frames to and
+// from BGR Mats.
+package y4m
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"gocv.io/x/gocv"
+)
+
+const (
+	signature   = "YUV4MPEG2"
+	frameMarker = "FRAME"
+
+	// DefaultColorspace is used when the header doesn't specify one.
+	DefaultColorspace = "420jpeg"
+)
+
+// Header holds the stream parameters from a YUV4MPEG2 header line.
+type Header struct {
+	Width      int
+	Height     int
+	Colorspace string
+
+	// Params holds the remaining header parameters (frame rate, interlacing,
+	// aspect ratio, comments) so they can be passed through unchanged.
+	Params []string
+}
+
+// ParseHeader parses a YUV4MPEG2 header line (without the trailing newline).
+func ParseHeader(line string) (Header, error) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 || fields[0] != signature {
+		return Header{}, fmt.Errorf("not a YUV4MPEG2 stream")
+	}
+	h := Header{Colorspace: DefaultColorspace}
+	for _, f := range fields[1:] {
+		var err error
+		switch f[0] {
+		case 'W':
+			h.Width, err = strconv.Atoi(f[1:])
+		case 'H':
+			h.Height, err = strconv.Atoi(f[1:])
+		case 'C':
+			h.Colorspace = f[1:]
+		default:
+			h.Params = append(h.Params, f)
+		}
+		if err != nil {
+			return Header{}, fmt.Errorf("parsing header parameter %s: %v", f, err)
+		}
+	}
+	if h.Width <= 0 || h.Height <= 0 {
+		return Header{}, fmt.Errorf("invalid frame size %dx%d", h.Width, h.Height)
+	}
+	return h, nil
+}
+
+func (h Header) String() string {
+	fields := []string{
+		signature,
+		fmt.Sprintf("W%d", h.Width),
+		fmt.Sprintf("H%d", h.Height),
+	}
+	fields = append(fields, h.Params...)
+	fields = append(fields, "C"+h.Colorspace)
+	return strings.Join(fields, " ")
+}
+
+// FrameSize returns the number of bytes of pixel data in each frame.
+func (h Header) FrameSize() (int, error) {
+	switch h.Colorspace {
+	case "420", "420jpeg", "420paldv", "420mpeg2":
+		if h.Width%2 != 0 || h.Height%2 != 0 {
+			return 0, fmt.Errorf("4:2:0 frames must have even dimensions, got %dx%d", h.Width, h.Height)
+		}
+		return h.Width * h.Height * 3 / 2, nil
+	case "444":
+		return h.Width * h.Height * 3, nil
+	case "mono":
+		return h.Width * h.Height, nil
+	}
+	return 0, fmt.Errorf("unsupported colorspace: %s", h.Colorspace)
+}
+
+// Reader decodes frames from a YUV4MPEG2 stream.
+type Reader struct {
+	Header Header
+
+	r   *bufio.Reader
+	buf []byte
+}
+
+// NewReader reads the stream header from r.
+func NewReader(r io.Reader) (*Reader, error) {
+	br := bufio.NewReader(r)
+	line, err := br.ReadString('\n')
+	if err != nil {
+		return nil, fmt.Errorf("reading header: %v", err)
+	}
+	h, err := ParseHeader(strings.TrimSuffix(line, "\n"))
+	if err != nil {
+		return nil, err
+	}
+	size, err := h.FrameSize()
+	if err != nil {
+		return nil, err
+	}
+	return &Reader{
+		Header: h,
+		r:      br,
+		buf:    make([]byte, size),
+	}, nil
+}
+
+// ReadFrame reads the next frame into dst as a BGR image. It returns io.EOF
+// when there are no more frames.
+func (r *Reader) ReadFrame(dst *gocv.Mat) error {
+	line, err := r.r.ReadString('\n')
+	if err == io.EOF && line == "" {
+		return io.EOF
+	}
+	if err != nil {
+		return fmt.Errorf("reading frame header: %v", err)
+	}
+	if !strings.HasPrefix(line, frameMarker) {
+		return fmt.Errorf("invalid frame header: %q", line)
+	}
+	_, err = io.ReadFull(r.r, r.buf)
+	if err != nil {
+		return fmt.Errorf("reading frame data: %v", err)
+	}
+
+	w, h := r.Header.Width, r.Header.Height
+	switch r.Header.Colorspace {
+	case "444":
+		planes := make([]gocv.Mat, 3)
+		for i := range planes {
+			planes[i], err = gocv.NewMatFromBytes(h, w, gocv.MatTypeCV8U, r.buf[i*w*h:(i+1)*w*h])
+			if err != nil {
+				return fmt.Errorf("creating plane %d: %v", i, err)
+			}
+			defer planes[i].Close()
+		}
+		yuv := gocv.NewMat()
+		defer yuv.Close()
+		gocv.Merge(planes, &yuv)
+		return gocv.CvtColor(yuv, dst, gocv.ColorYUVToBGR)
+	case "mono":
+		gray, err := gocv.NewMatFromBytes(h, w, gocv.MatTypeCV8U, r.buf)
+		if err != nil {
+			return fmt.Errorf("creating frame: %v", err)
+		}
+		defer gray.Close()
+		return gocv.CvtColor(gray, dst, gocv.ColorGrayToBGR)
+	}
+	yuv, err := gocv.NewMatFromBytes(h*3/2, w, gocv.MatTypeCV8U, r.buf)
+	if err != nil {
+		return fmt.Errorf("creating frame: %v", err)
+	}
+	defer yuv.Close()
+	return gocv.CvtColor(yuv, dst, gocv.ColorYUVToBGRIYUV)
+}
+
+// Writer encodes BGR frames as a YUV4MPEG2 stream.
+type Writer struct {
+	Header Header
+
+	w *bufio.Writer
+}
+
+// NewWriter writes the stream header to w.
+func NewWriter(w io.Writer, h Header) (*Writer, error) {
+	_, err := h.FrameSize()
+	if err != nil {
+		return nil, err
+	}
+	bw := bufio.NewWriter(w)
+	_, err = bw.WriteString(h.String() + "\n")
+	if err != nil {
+		return nil, fmt.Errorf("writing header: %v", err)
+	}
+	return &Writer{Header: h, w: bw}, nil
+}
+
+// WriteFrame converts src from BGR and writes it as the next frame.
+func (w *Writer) WriteFrame(src gocv.Mat) error {
+	if src.Cols() != w.Header.Width || src.Rows() != w.Header.Height {
+		return fmt.Errorf("frame is %dx%d, stream is %dx%d", src.Cols(), src.Rows(), w.Header.Width, w.Header.Height)
+	}
+	_, err := w.w.WriteString(frameMarker + "\n")
+	if err != nil {
+		return fmt.Errorf("writing frame header: %v", err)
+	}
+	converted := gocv.NewMat()
+	defer converted.Close()
+	switch w.Header.Colorspace {
+	case "444":
+		gocv.CvtColor(src, &converted, gocv.ColorBGRToYUV)
+		planes := gocv.Split(converted)
+		for _, p := range planes {
+			defer p.Close()
+		}
+		for _, p := range planes {
+			_, err = w.w.Write(p.ToBytes())
+			if err != nil {
+				return fmt.Errorf("writing frame data: %v", err)
+			}
+		}
+		return nil
+	case "mono":
+		gocv.CvtColor(src, &converted, gocv.ColorBGRToGray)
+	default:
+		gocv.CvtColor(src, &converted, gocv.ColorBGRToYUVI420)
+	}
+	_, err = w.w.Write(converted.ToBytes())
+	if err != nil {
+		return fmt.Errorf("writing frame data: %v", err)
+	}
+	return nil
+}
+
+// Flush writes any buffered frame data to the underlying writer.
+func (w *Writer) Flush() error {
+	return w.w.Flush()
+}
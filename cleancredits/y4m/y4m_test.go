@@ -0,0 +1,254 @@
+package y4m
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gocv.io/x/gocv"
+)
+
+func TestParseHeader(t *testing.T) {
+	cases := []struct {
+		name string
+		line string
+		want Header
+	}{
+		{
+			name: "default colorspace",
+			line: "YUV4MPEG2 W4 H2 F25:1",
+			want: Header{Width: 4, Height: 2, Colorspace: DefaultColorspace, Params: []string{"F25:1"}},
+		},
+		{
+			name: "420",
+			line: "YUV4MPEG2 W1920 H1080 F24000:1001 C420mpeg2",
+			want: Header{Width: 1920, Height: 1080, Colorspace: "420mpeg2", Params: []string{"F24000:1001"}},
+		},
+		{
+			name: "444",
+			line: "YUV4MPEG2 C444 W3 H3 F30:1",
+			want: Header{Width: 3, Height: 3, Colorspace: "444", Params: []string{"F30:1"}},
+		},
+		{
+			name: "mono",
+			line: "YUV4MPEG2 W5 H7 Cmono",
+			want: Header{Width: 5, Height: 7, Colorspace: "mono"},
+		},
+		{
+			name: "interlace, aspect and comments are kept",
+			line: "YUV4MPEG2 W720 H576 F25:1 It A59:54 C420paldv XYSCSS=420PALDV",
+			want: Header{
+				Width:      720,
+				Height:     576,
+				Colorspace: "420paldv",
+				Params:     []string{"F25:1", "It", "A59:54", "XYSCSS=420PALDV"},
+			},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := ParseHeader(tc.line)
+			if err != nil {
+				t.Fatalf("ParseHeader returned error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("ParseHeader = %+v, want %+v", got, tc.want)
+			}
+			// The header is written back with the same parameters.
+			again, err := ParseHeader(got.String())
+			if err != nil {
+				t.Fatalf("ParseHeader(%q) returned error: %v", got.String(), err)
+			}
+			if !reflect.DeepEqual(again, tc.want) {
+				t.Errorf("ParseHeader(%q) = %+v, want %+v", got.String(), again, tc.want)
+			}
+		})
+	}
+}
+
+func TestParseHeader_malformed(t *testing.T) {
+	for _, line := range []string{
+		"",
+		"YUV4MPEG W4 H2",
+		"W4 H2 YUV4MPEG2",
+		"YUV4MPEG2 H2",
+		"YUV4MPEG2 W4",
+		"YUV4MPEG2 W0 H2",
+		"YUV4MPEG2 W-4 H2",
+		"YUV4MPEG2 Wfour H2",
+		"YUV4MPEG2 W4 H2.5",
+	} {
+		_, err := ParseHeader(line)
+		if err == nil {
+			t.Errorf("ParseHeader(%q) didn't return an error", line)
+		}
+	}
+}
+
+func TestHeader_FrameSize(t *testing.T) {
+	cases := []struct {
+		colorspace    string
+		width, height int
+		want          int
+		wantErr       bool
+	}{
+		{colorspace: "420", width: 4, height: 2, want: 12},
+		{colorspace: "420jpeg", width: 4, height: 2, want: 12},
+		{colorspace: "420paldv", width: 720, height: 576, want: 622080},
+		{colorspace: "420mpeg2", width: 2, height: 2, want: 6},
+		{colorspace: "420jpeg", width: 3, height: 2, wantErr: true},
+		{colorspace: "420jpeg", width: 4, height: 3, wantErr: true},
+		{colorspace: "444", width: 3, height: 3, want: 27},
+		{colorspace: "mono", width: 5, height: 7, want: 35},
+		{colorspace: "422", width: 4, height: 2, wantErr: true},
+	}
+	for _, tc := range cases {
+		h := Header{Width: tc.width, Height: tc.height, Colorspace: tc.colorspace}
+		got, err := h.FrameSize()
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("FrameSize(%s %dx%d) didn't return an error", tc.colorspace, tc.width, tc.height)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("FrameSize(%s %dx%d) returned error: %v", tc.colorspace, tc.width, tc.height, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("FrameSize(%s %dx%d) = %d, want %d", tc.colorspace, tc.width, tc.height, got, tc.want)
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	// Flat frames survive chroma subsampling, so only rounding in the color
+	// conversions is lost.
+	colors := []gocv.Scalar{
+		gocv.NewScalar(40, 80, 160, 0),
+		gocv.NewScalar(200, 30, 90, 0),
+	}
+	cases := []struct {
+		colorspace string
+		gray       bool
+	}{
+		{colorspace: "420jpeg"},
+		{colorspace: "444"},
+		{colorspace: "mono", gray: true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.colorspace, func(t *testing.T) {
+			h := Header{Width: 8, Height: 4, Colorspace: tc.colorspace, Params: []string{"F25:1", "Ip", "A1:1"}}
+			var buf bytes.Buffer
+			w, err := NewWriter(&buf, h)
+			if err != nil {
+				t.Fatalf("NewWriter returned error: %v", err)
+			}
+			var frames []gocv.Mat
+			for _, c := range colors {
+				if tc.gray {
+					c = gocv.NewScalar(c.Val1, c.Val1, c.Val1, 0)
+				}
+				frame := gocv.NewMatWithSizeFromScalar(c, h.Height, h.Width, gocv.MatTypeCV8UC3)
+				defer frame.Close()
+				frames = append(frames, frame)
+				err := w.WriteFrame(frame)
+				if err != nil {
+					t.Fatalf("WriteFrame returned error: %v", err)
+				}
+			}
+			err = w.Flush()
+			if err != nil {
+				t.Fatalf("Flush returned error: %v", err)
+			}
+
+			r, err := NewReader(&buf)
+			if err != nil {
+				t.Fatalf("NewReader returned error: %v", err)
+			}
+			if !reflect.DeepEqual(r.Header, h) {
+				t.Errorf("read header %+v, want %+v", r.Header, h)
+			}
+			got := gocv.NewMat()
+			defer got.Close()
+			for i, want := range frames {
+				err := r.ReadFrame(&got)
+				if err != nil {
+					t.Fatalf("ReadFrame(%d) returned error: %v", i, err)
+				}
+				if got.Cols() != want.Cols() || got.Rows() != want.Rows() {
+					t.Fatalf("frame %d is %dx%d, want %dx%d", i, got.Cols(), got.Rows(), want.Cols(), want.Rows())
+				}
+				wantBytes := want.ToBytes()
+				for j, b := range got.ToBytes() {
+					if d := int(b) - int(wantBytes[j]); d < -4 || d > 4 {
+						t.Errorf("frame %d byte %d = %d, want %d", i, j, b, wantBytes[j])
+						break
+					}
+				}
+			}
+			err = r.ReadFrame(&got)
+			if err != io.EOF {
+				t.Errorf("ReadFrame after the last frame returned %v, want io.EOF", err)
+			}
+		})
+	}
+}
+
+func TestReader_truncated(t *testing.T) {
+	const header = "YUV4MPEG2 W4 H2 C420jpeg\n"
+	frame := "FRAME\n" + strings.Repeat("\x80", 12)
+	cases := []struct {
+		name    string
+		stream  string
+		wantEOF bool
+	}{
+		{name: "no frames", stream: header, wantEOF: true},
+		{name: "after a whole frame", stream: header + frame, wantEOF: true},
+		{name: "partial frame data", stream: header + frame[:len(frame)-1]},
+		{name: "no frame data", stream: header + "FRAME\n"},
+		{name: "partial frame header", stream: header + "FRA"},
+		{name: "bad frame header", stream: header + "FRAMX\n" + strings.Repeat("\x80", 12)},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := NewReader(strings.NewReader(tc.stream))
+			if err != nil {
+				t.Fatalf("NewReader returned error: %v", err)
+			}
+			mat := gocv.NewMat()
+			defer mat.Close()
+			// Read any whole frames first.
+			for range strings.Count(tc.stream, frame) {
+				err := r.ReadFrame(&mat)
+				if err != nil {
+					t.Fatalf("ReadFrame returned error: %v", err)
+				}
+			}
+			err = r.ReadFrame(&mat)
+			if tc.wantEOF && err != io.EOF {
+				t.Errorf("ReadFrame returned %v, want io.EOF", err)
+			}
+			if !tc.wantEOF && (err == nil || err == io.EOF) {
+				t.Errorf("ReadFrame returned %v, want an error other than io.EOF", err)
+			}
+		})
+	}
+}
+
+func TestNewReader_malformed(t *testing.T) {
+	for _, stream := range []string{
+		"",
+		"YUV4MPEG2 W4 H2",
+		"YUV4MPEG2 W4 H2 C422\n",
+		"YUV4MPEG2 W3 H2 C420jpeg\n",
+		"RIFF\n",
+	} {
+		_, err := NewReader(strings.NewReader(stream))
+		if err == nil {
+			t.Errorf("NewReader(%q) didn't return an error", stream)
+		}
+	}
+}
@@ -18,6 +18,8 @@ import (
 var cpuprofile = flag.String("cpuprofile", "", "write cpu profile to file")
 var memprofile = flag.String("memprofile", "", "write heap (memory) profile to file")
 var profserver = flag.Bool("profserver", false, "start profiling server; view at http://localhost:6060/debug/pprof/")
+var projectFile = flag.String("project", "", "project file saved from the Render tab; used with -y4m")
+var y4mStream = flag.Bool("y4m", false, "read YUV4MPEG2 frames from stdin, clean them using -project and write YUV4MPEG2 to stdout")
 
 func main() {
 	flag.Parse()
@@ -35,9 +37,21 @@ func main() {
 			log.Println(http.ListenAndServe("localhost:6060", nil))
 		}()
 	}
-	a := app.NewWithID("com.github.sandalwoodbox.cleancredits")
-	w := cleancredits.NewMainWindow(a)
-	w.ShowAndRun()
+	exitCode := 0
+	if *y4mStream {
+		// Keep log output out of the video stream.
+		out := os.Stdout
+		os.Stdout = os.Stderr
+		err := cleancredits.RunY4M(*projectFile, os.Stdin, out)
+		if err != nil {
+			fmt.Println("Error streaming y4m: ", err)
+			exitCode = 1
+		}
+	} else {
+		a := app.NewWithID("com.github.sandalwoodbox.cleancredits")
+		w := cleancredits.NewMainWindow(a)
+		w.ShowAndRun()
+	}
 	if *memprofile != "" {
 		f, err := os.Create(*memprofile)
 		if err != nil {
@@ -47,4 +61,8 @@ func main() {
 			f.Close()
 		}
 	}
+	if exitCode != 0 {
+		pprof.StopCPUProfile()
+		os.Exit(exitCode)
+	}
 }